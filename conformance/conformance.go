@@ -0,0 +1,168 @@
+// Package conformance checks the NFA and DFA engines of lexmachine agree. A
+// Lexer compiled with CompileNFA should produce exactly the same tokens,
+// positions and errors as one compiled with CompileDFA. The package runs a
+// corpus of lexers and texts through both engines and reports the first place
+// they differ.
+//
+// Downstream projects can check their own lexers in their tests:
+//
+//     func TestEngines(t *testing.T) {
+//         conformance.Check(t, conformance.Case{
+//             Name:  "mylang",
+//             Lexer: newLexer, // a func() *lexmachine.Lexer
+//             Texts: []string{"x = 1", "if (y) { z }", "bad $input"},
+//         })
+//     }
+//
+// The built in Corpus covers the parts of the engines which have had bugs:
+// backtracking to the last accepting state, priorities, unmatched input and
+// Actions which move the Scanner's TC (forwards and backwards).
+package conformance
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/timtadh/lexmachine"
+	"github.com/timtadh/lexmachine/machines"
+)
+
+// A Case is a lexer and the texts to scan with it.
+type Case struct {
+	Name  string
+	Lexer func() *lexmachine.Lexer // creates a new (uncompiled) lexer, it is called once per engine
+	Texts []string
+}
+
+// An Event is the result of one call to Scanner.Next. After an
+// UnconsumedInput error scanning resumes after the unmatched text (like an
+// editor highlighting a file would), after any other error it stops.
+type Event struct {
+	Token interface{} // the token returned by Next (nil on errors)
+	Err   error       // the error returned by Next
+	TC    int         // the Scanner's TC after Next returned
+}
+
+func (e *Event) String() string {
+	if e == nil {
+		return "the end of the text"
+	} else if e.Err != nil {
+		return fmt.Sprintf("error %v (TC %d)", e.Err, e.TC)
+	}
+	return fmt.Sprintf("token %v (TC %d)", e.Token, e.TC)
+}
+
+// Scan scans text with lexer (which should already be compiled) and returns
+// the events up to the end of the text or the first error which is not an
+// UnconsumedInput.
+func Scan(lexer *lexmachine.Lexer, text []byte) ([]*Event, error) {
+	scanner, err := lexer.Scanner(text)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]*Event, 0, 10)
+	for tok, err, eos := scanner.Next(); !eos; tok, err, eos = scanner.Next() {
+		events = append(events, &Event{Token: tok, Err: err, TC: scanner.TC})
+		if ui, is := err.(*machines.UnconsumedInput); is {
+			scanner.TC = ui.FailTC
+			if ui.FailTC <= ui.StartTC {
+				scanner.TC = ui.StartTC + 1
+			}
+		} else if err != nil {
+			break
+		}
+	}
+	return events, nil
+}
+
+// A Mismatch is where the engines disagree on a text. It is an error.
+type Mismatch struct {
+	Case     string
+	Text     []byte
+	Index    int    // the index of the first events which differ (-1 if the compile errors differ)
+	NFA, DFA *Event // the events which differ (nil if the engine ran out of events)
+	NFAErr   error  // the error compiling (or creating the Scanner) for the NFA
+	DFAErr   error  // the error compiling (or creating the Scanner) for the DFA
+}
+
+func (m *Mismatch) Error() string {
+	if m.Index < 0 {
+		return fmt.Sprintf("%s: the NFA error (%v) differs from the DFA error (%v) on %q", m.Case, m.NFAErr, m.DFAErr, m.Text)
+	}
+	return fmt.Sprintf("%s: event %d of %q differs, the NFA got %v but the DFA got %v", m.Case, m.Index, m.Text, m.NFA, m.DFA)
+}
+
+// Compare compiles a lexer from newLexer with each engine, scans text with
+// both and returns a *Mismatch if they disagree. Lexers which fail to compile
+// are equivalent if both engines fail.
+func Compare(newLexer func() *lexmachine.Lexer, text []byte) error {
+	return compare("", newLexer, text)
+}
+
+func compare(name string, newLexer func() *lexmachine.Lexer, text []byte) error {
+	nfa, nfaErr := scan(newLexer(), (*lexmachine.Lexer).CompileNFA, text)
+	dfa, dfaErr := scan(newLexer(), (*lexmachine.Lexer).CompileDFA, text)
+	if (nfaErr == nil) != (dfaErr == nil) {
+		return &Mismatch{Case: name, Text: text, Index: -1, NFAErr: nfaErr, DFAErr: dfaErr}
+	}
+	for i := 0; i < len(nfa) || i < len(dfa); i++ {
+		var n, d *Event
+		if i < len(nfa) {
+			n = nfa[i]
+		}
+		if i < len(dfa) {
+			d = dfa[i]
+		}
+		if !sameEvent(n, d) {
+			return &Mismatch{Case: name, Text: text, Index: i, NFA: n, DFA: d}
+		}
+	}
+	return nil
+}
+
+func scan(lexer *lexmachine.Lexer, compile func(*lexmachine.Lexer) error, text []byte) ([]*Event, error) {
+	if err := compile(lexer); err != nil {
+		return nil, err
+	}
+	return Scan(lexer, text)
+}
+
+// sameEvent checks if the engines produced the same event. Errors from the
+// engines are compared by their positions (the MatchID of an
+// EmptyMatchError is a program counter for the NFA but a match-id for the
+// DFA), other errors by their messages.
+func sameEvent(a, b *Event) bool {
+	if a == nil || b == nil {
+		return a == b
+	} else if a.TC != b.TC || !reflect.DeepEqual(a.Token, b.Token) {
+		return false
+	}
+	switch x := a.Err.(type) {
+	case nil:
+		return b.Err == nil
+	case *machines.UnconsumedInput:
+		y, is := b.Err.(*machines.UnconsumedInput)
+		return is &&
+			x.StartTC == y.StartTC && x.FailTC == y.FailTC &&
+			x.StartLine == y.StartLine && x.StartColumn == y.StartColumn &&
+			x.FailLine == y.FailLine && x.FailColumn == y.FailColumn
+	case *machines.EmptyMatchError:
+		y, is := b.Err.(*machines.EmptyMatchError)
+		return is && x.TC == y.TC && x.Line == y.Line && x.Column == y.Column
+	}
+	return b.Err != nil && a.Err.Error() == b.Err.Error()
+}
+
+// Check compares the engines on every text of every case and reports each
+// mismatch as an error to t.
+func Check(t testing.TB, cases ...Case) {
+	t.Helper()
+	for _, c := range cases {
+		for _, text := range c.Texts {
+			if err := compare(c.Name, c.Lexer, []byte(text)); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package conformance
+
+import (
+	"testing"
+
+	"github.com/timtadh/data-structures/test"
+	"github.com/timtadh/lexmachine"
+	"github.com/timtadh/lexmachine/machines"
+)
+
+func TestCorpus(t *testing.T) {
+	Check(t, Corpus...)
+}
+
+func TestCompareFindsMismatches(x *testing.T) {
+	t := (*test.T)(x)
+	// the action behaves differently under each engine so the comparison
+	// must notice
+	engines := 0
+	newLexer := func() *lexmachine.Lexer {
+		typ := engines
+		engines++
+		l := lexmachine.NewLexer()
+		l.Add([]byte(`[a-z]+`), func(s *lexmachine.Scanner, m *machines.Match) (interface{}, error) {
+			return s.Token(typ, nil, m), nil
+		})
+		return l
+	}
+	err := Compare(newLexer, []byte("abc"))
+	m, is := err.(*Mismatch)
+	t.Assert(is, "expected a *Mismatch got %v", err)
+	t.Assert(m.Index == 0, "expected the first event to differ got %v", m)
+
+	t.AssertNil(Compare(lexer(`[a-z]+`, `_`), []byte("abc $ def")))
+}
+
+func TestScan(x *testing.T) {
+	t := (*test.T)(x)
+	l := lexer(`[a-z]+`, `_`)()
+	t.AssertNil(l.CompileDFA())
+	events, err := Scan(l, []byte("ab $$ c"))
+	t.AssertNil(err)
+	t.Assert(len(events) == 4, "expected 4 events got %v", events)
+	_, is := events[1].Err.(*machines.UnconsumedInput)
+	t.Assert(is, "expected unconsumed input got %v", events[1])
+	tok := events[3].Token.(*lexmachine.Token)
+	t.Assert(string(tok.Lexeme) == "c" && tok.TC == 6, "got %v", tok)
+}
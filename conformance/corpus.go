@@ -0,0 +1,160 @@
+package conformance
+
+import (
+	"fmt"
+
+	"github.com/timtadh/lexmachine"
+	"github.com/timtadh/lexmachine/machines"
+)
+
+// token returns an Action producing a *lexmachine.Token of type typ.
+func token(typ int) lexmachine.Action {
+	return func(s *lexmachine.Scanner, m *machines.Match) (interface{}, error) {
+		return s.Token(typ, string(m.Bytes), m), nil
+	}
+}
+
+func skip(*lexmachine.Scanner, *machines.Match) (interface{}, error) {
+	return nil, nil
+}
+
+// lexer builds a lexer where the nth pattern produces tokens of type n. The
+// pattern "_" is replaced by a whitespace pattern which is skipped.
+func lexer(patterns ...string) func() *lexmachine.Lexer {
+	return func() *lexmachine.Lexer {
+		l := lexmachine.NewLexer()
+		for i, p := range patterns {
+			if p == "_" {
+				l.Add([]byte(`( |\t|\n|\r)+`), skip)
+			} else {
+				l.Add([]byte(p), token(i))
+			}
+		}
+		return l
+	}
+}
+
+// Corpus is the built in set of cases. See Check.
+var Corpus = []Case{
+	{
+		Name:  "keywords",
+		Lexer: lexer(`if`, `iff`, `print`, `[a-z]+`, `[0-9]+`, `=`, `_`),
+		Texts: []string{
+			"", "if", "iff", "ifff", "i", "print printer", "x = 10\ny=2",
+			"if x = 1 $ iff", "$$$", "a\n\n  $\n b", "12ab 3",
+		},
+	},
+	{
+		Name:  "backtracking",
+		Lexer: lexer(`a`, `abc`, `ab(cd)+e`, `b`, `c`, `d`),
+		Texts: []string{
+			"abc", "abab", "abcdcde", "abcdcd", "abcdcdx", "aabcdeab", "abx", "x",
+		},
+	},
+	{
+		Name:  "priority",
+		Lexer: lexer(`[a-z]+`, `[a-c]+`, `abc`, `.`),
+		Texts: []string{"abc", "cab", "abcd", "a b\nc", "\xff\x00abc"},
+	},
+	{
+		Name: "strings",
+		Lexer: lexer(
+			`"([^"\\]|\\.)*"`,
+			`'''([^']|'[^']|''[^'])*'''`,
+			`'([^'\\]|\\.)*'`,
+			`[a-zA-Z_][a-zA-Z0-9_]*`,
+			`_`,
+		),
+		Texts: []string{
+			`"a" "b\"c" x`, "'''x\ny'' '''", `'unclosed`, `"unclosed \"`, "'''a''b'c'''",
+			"\"multi\nline\"\n'x'", `""''""`,
+		},
+	},
+	{
+		Name:  "classes",
+		Lexer: lexer(`\d+`, `\w+`, `\s+`, `[^\w\s]`),
+		Texts: []string{"abc 123 a_1", "x+y*(z-1)", "\t\n\r\f\v", "é 日本"},
+	},
+	{
+		Name:  "repeats",
+		Lexer: lexer(`(a|b)*abb`, `a**b`, `(ab?)+c`, `(a|b)+`),
+		Texts: []string{"abb", "aababb", "ab", "aaab", "abababc", "ac", "abba", "b", "c"},
+	},
+	{
+		Name: "comments",
+		Lexer: func() *lexmachine.Lexer {
+			l := lexer(`[a-z]+`, `/`, `_`)()
+			// skip a block comment by moving the TC past the end of it
+			l.Add([]byte(`/\*`), func(s *lexmachine.Scanner, m *machines.Match) (interface{}, error) {
+				for tc := s.TC; tc+1 < len(s.Text); tc++ {
+					if s.Text[tc] == '*' && s.Text[tc+1] == '/' {
+						s.TC = tc + 2
+						return nil, nil
+					}
+				}
+				return nil, fmt.Errorf("unclosed comment at %d:%d", m.StartLine, m.StartColumn)
+			})
+			return l
+		},
+		Texts: []string{"a /* b */ c", "a/**/b", "a /* b\n*/ c /", "a /* b", "/*/ */x"},
+	},
+	{
+		Name: "rewind",
+		Lexer: func() *lexmachine.Lexer {
+			l := lexer(`[a-z]+`, `:`, `[0-9]+`, `_`)()
+			// a label is a name followed by a colon, the colon is rewound
+			// so it is lexed again as its own token
+			l.Add([]byte(`[a-z]+:`), func(s *lexmachine.Scanner, m *machines.Match) (interface{}, error) {
+				s.TC--
+				return s.Token(4, string(m.Bytes[:len(m.Bytes)-1]), m), nil
+			})
+			// a number range rewinds to just after the first number so the
+			// second number is a token of its own
+			l.Add([]byte(`[0-9]+\.\.[0-9]+`), func(s *lexmachine.Scanner, m *machines.Match) (interface{}, error) {
+				i := 0
+				for m.Bytes[i] != '.' {
+					i++
+				}
+				s.TC = m.TC + i + 2
+				return s.Token(5, string(m.Bytes[:i]), m), nil
+			})
+			return l
+		},
+		Texts: []string{"a: b", "abc:\nd:e", "1..2 3..45", "x: 1..", "1...2", ":::"},
+	},
+	{
+		Name:  "empty",
+		Lexer: lexer(`a`, `b*`),
+		Texts: []string{"", "ab"},
+	},
+	{
+		Name: "setops",
+		Lexer: func() *lexmachine.Lexer {
+			l := lexmachine.NewLexer()
+			l.AddSetOps([]byte(`[a-z]+--(if|in)`), token(0))
+			l.Add([]byte(`if|in`), token(1))
+			l.AddSetOps([]byte(`/\*~(.*\*/.*)\*/`), token(2))
+			l.AddSetOps([]byte(`[a-z]*a[a-z]*&[a-z]*b[a-z]*`), token(3))
+			l.Add([]byte(`&&|--|~`), token(4))
+			l.Add([]byte(`.`), token(5))
+			l.Add([]byte(`( |\t|\n|\r)+`), skip)
+			return l
+		},
+		Texts: []string{"if in int x", "ab ba abc", "/* a */ b */", "/* a", "~&--&&", ""},
+	},
+	{
+		Name: "shortest",
+		Lexer: func() *lexmachine.Lexer {
+			l := lexer(`[a-z]+`, `<`, `-`, `_`)()
+			l.AddShortest([]byte(`<!\-\-.*\-\->`), token(4))
+			l.AddShortest([]byte(`a+`), token(5))
+			return l
+		},
+		Texts: []string{"<!-- a --> b -->", "<!--->", "<!-- x", "baaa aaab", "a<!---->-->"},
+	},
+	{
+		Name:  "unclosed",
+		Lexer: lexer(`abcd`, `a`, `_`),
+		Texts: []string{"abc", "a abc", "abcd abc", "ab\nabc"},
+	},
+}
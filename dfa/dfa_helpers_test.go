@@ -36,7 +36,9 @@ func TestLabeledAst(x *testing.T) {
 	} {
 		ast, err := frontend.Parse([]byte(regex))
 		t.AssertNil(err)
-		verify(frontend.DesugarRanges(ast))
+		desugared, err := frontend.DesugarRanges(ast)
+		t.AssertNil(err)
+		verify(desugared)
 	}
 }
 
@@ -26,7 +26,22 @@ type DFA struct {
 
 // Generate a DFA from a regular expressions AST. The generated DFA is
 // minimized during the generation process.
-func Generate(root frontend.AST) *DFA {
+func Generate(root frontend.AST) (*DFA, error) {
+	dfa, err := GenerateUnminimized(root)
+	if err != nil {
+		return nil, err
+	}
+	return dfa.minimize()
+}
+
+// GenerateUnminimized generates a DFA from a regular expressions AST with the
+// subset construction but does not minimize it. It is mostly useful for
+// visualizing the construction. An AST with set operators (see
+// frontend.HasSetOps) is generated with the product construction instead.
+func GenerateUnminimized(root frontend.AST) (*DFA, error) {
+	if frontend.HasSetOps(root) {
+		return generateSetOps(root), nil
+	}
 	ast := Label(root)
 	positions := ast.Positions
 	first, follow := ast.Follow()
@@ -47,7 +62,7 @@ func Generate(root frontend.AST) *DFA {
 	for unmarked.Size() > 0 {
 		x, err := unmarked.Pop()
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
 		s := x.(*set.SortedSet)
 		posBySymbol := make(map[int][]int)
@@ -83,29 +98,32 @@ func Generate(root frontend.AST) *DFA {
 				}
 				x, err := trans.Get(s)
 				if err != nil {
-					panic(err)
+					return nil, err
 				}
 				t := x.(map[byte]*set.SortedSet)
 				t[byte(symbol)] = pFollow
 			} else {
-				panic("symbol outside of range")
+				return nil, fmt.Errorf("symbol %d outside of range", symbol)
 			}
 		}
 	}
 
-	idx := func(state *set.SortedSet) int {
+	idx := func(state *set.SortedSet) (int, error) {
 		i, has, err := states.Find(state)
 		if err != nil {
-			panic(err)
-		}
-		if !has {
-			panic(fmt.Errorf("missing state %v", state))
+			return 0, err
+		} else if !has {
+			return 0, fmt.Errorf("missing state %v", state)
 		}
-		return i
+		return i + 1, nil
 	}
 
+	startIdx, err := idx(start)
+	if err != nil {
+		return nil, err
+	}
 	dfa := &DFA{
-		Start:     idx(start) + 1,
+		Start:     startIdx,
 		Matches:   make([][]int, len(ast.Matches)),
 		Accepting: make(machines.DFAAccepting),
 		Trans:     make(machines.DFATrans, trans.Size()+1),
@@ -113,9 +131,16 @@ func Generate(root frontend.AST) *DFA {
 	for k, v, next := trans.Iterate()(); next != nil; k, v, next = next() {
 		from := k.(*set.SortedSet)
 		toMap := v.(map[byte]*set.SortedSet)
-		fromIdx := idx(from) + 1
+		fromIdx, err := idx(from)
+		if err != nil {
+			return nil, err
+		}
 		for symbol, to := range toMap {
-			dfa.Trans[fromIdx][symbol] = idx(to) + 1
+			toIdx, err := idx(to)
+			if err != nil {
+				return nil, err
+			}
+			dfa.Trans[fromIdx][symbol] = toIdx
 		}
 		if accepting.Has(from) {
 			idx := 0
@@ -125,14 +150,14 @@ func Generate(root frontend.AST) *DFA {
 				}
 			}
 			if idx >= len(ast.Matches) {
-				panic(fmt.Errorf("Could not find any of %v in %v", ast.Matches, from))
+				return nil, fmt.Errorf("Could not find any of %v in %v", ast.Matches, from)
 			}
 			dfa.Matches[idx] = append(dfa.Matches[idx], fromIdx)
 			dfa.Accepting[fromIdx] = idx
 		}
 	}
 
-	return dfa.minimize()
+	return dfa, nil
 }
 
 func makeDState(positions []int) *set.SortedSet {
@@ -172,21 +197,32 @@ func (dfa *DFA) String() string {
 // Dotty translates the DFA into Graphviz source code suitable for visualization with
 // the `dot` command.
 func (dfa *DFA) Dotty() string {
+	return dfa.DottyLabeled(nil)
+}
+
+// DottyLabeled is Dotty with the accepting states labeled by labels[match-id]
+// (for instance the pattern or the name of the token) rather than the
+// match-id.
+func (dfa *DFA) DottyLabeled(labels []string) string {
 	lines := make([]string, 0, len(dfa.Trans))
 	lines = append(lines, "digraph DFA {")
 	lines = append(lines, "rankdir=LR")
 	lines = append(lines, "node [shape=circle]")
 	lines = append(lines, `start [shape="none", label=""]`)
 	lines = append(lines, fmt.Sprintf("start -> %d [label=start]", dfa.Start))
-	for i, matches := range dfa.Matches {
-		for _, m := range matches {
-			lines = append(lines, fmt.Sprintf(`%d [style=bold, peripheries=2, xlabel="matches %d"]`, m, i))
-		}
-	}
 	quote := func(s string) string {
 		q := strconv.Quote(s)
 		return q[1 : len(q)-1]
 	}
+	for i, matches := range dfa.Matches {
+		label := fmt.Sprintf("matches %d", i)
+		if i < len(labels) {
+			label = quote(labels[i])
+		}
+		for _, m := range matches {
+			lines = append(lines, fmt.Sprintf(`%d [style=bold, peripheries=2, xlabel="%s"]`, m, label))
+		}
+	}
 	for i, row := range dfa.Trans {
 		ranges := make(map[int][]struct{ beg, end int })
 		target := -1
@@ -263,9 +299,9 @@ func (dfa *DFA) match(text string) int {
 	return -1
 }
 
-func (dfa *DFA) minimize() *DFA {
+func (dfa *DFA) minimize() (*DFA, error) {
 	if dfa.minimal {
-		return dfa
+		return dfa, nil
 	}
 
 	accepting := set.NewSortedSet(10)
@@ -296,60 +332,66 @@ func (dfa *DFA) minimize() *DFA {
 		partition.Add(nonAccepting)
 	}
 
-	replace := func(i int, replacement *set.SortedSet) int {
+	replace := func(i int, replacement *set.SortedSet) (int, error) {
 		err := partition.Remove(i)
 		if err != nil {
-			panic(err)
+			return 0, err
 		}
 		err = partition.Extend(replacement.Items())
 		if err != nil {
-			panic(err)
+			return 0, err
 		}
 		first, err := replacement.Get(0)
 		if err != nil {
-			panic(err)
+			return 0, err
 		}
 		i, has, err := partition.Find(first)
 		if err != nil {
-			panic(err)
+			return 0, err
 		} else if !has {
-			panic(fmt.Errorf("Could not find %v in %v", first, partition))
+			return 0, fmt.Errorf("Could not find %v in %v", first, partition)
 		}
-		return i
+		return i, nil
 	}
 
-	findGroup := func(s int) int {
+	findGroup := func(s int) (int, error) {
 		i := 0
 		for v, next := partition.Items()(); next != nil; v, next = next() {
 			g := v.(*set.SortedSet)
 			if g.Has(types.Int(s)) {
-				return i
+				return i, nil
 			}
 			i++
 		}
-		panic(fmt.Errorf("Could not find a group for %v in %v", s, partition))
+		return 0, fmt.Errorf("Could not find a group for %v in %v", s, partition)
 	}
 
-	equivalent := func(s int, ec *set.SortedSet) bool {
+	equivalent := func(s int, ec *set.SortedSet) (bool, error) {
 		x, err := ec.Get(0)
 		if err != nil {
-			panic(err)
+			return false, err
 		}
 		t := int(x.(types.Int))
 		for sym := 0; sym < 256; sym++ {
-			a := findGroup(dfa.Trans[s][sym])
-			b := findGroup(dfa.Trans[t][sym])
-			if a != b || a < 0 || b < 0 {
-				return false
+			a, err := findGroup(dfa.Trans[s][sym])
+			if err != nil {
+				return false, err
+			}
+			b, err := findGroup(dfa.Trans[t][sym])
+			if err != nil {
+				return false, err
+			}
+			if a != b {
+				return false, nil
 			}
 		}
-		return true
+		return true, nil
 	}
 
 	for i := 0; i < partition.Size(); i++ {
 		g, err := partition.Get(i)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
 		group := g.(*set.SortedSet)
 		subgroups := set.NewSortedSet(10)
@@ -358,7 +400,9 @@ func (dfa *DFA) minimize() *DFA {
 			found := false
 			for ec, next := subgroups.Items()(); next != nil; ec, next = next() {
 				eqClass := ec.(*set.SortedSet)
-				if equivalent(state, eqClass) {
+				if eq, err := equivalent(state, eqClass); err != nil {
+					return nil, err
+				} else if eq {
 					eqClass.Add(types.Int(state))
 					found = true
 					break
@@ -371,20 +415,32 @@ func (dfa *DFA) minimize() *DFA {
 			}
 		}
 		if subgroups.Size() > 1 {
-			i = replace(i, subgroups) - 1
+			j, err := replace(i, subgroups)
+			if err != nil {
+				return nil, err
+			}
+			i = j - 1
 		}
 	}
 
 	// if the dfa is already minimal return it
 	if partition.Size() == len(dfa.Trans) {
 		dfa.minimal = true
-		return dfa
+		return dfa, nil
 	}
 
+	errGroup, err := findGroup(dfa.Error)
+	if err != nil {
+		return nil, err
+	}
+	startGroup, err := findGroup(dfa.Start)
+	if err != nil {
+		return nil, err
+	}
 	newdfa := &DFA{
 		minimal:   true,
-		Error:     findGroup(dfa.Error),
-		Start:     findGroup(dfa.Start),
+		Error:     errGroup,
+		Start:     startGroup,
 		Matches:   make([][]int, len(dfa.Matches)),
 		Accepting: make(machines.DFAAccepting),
 		Trans:     make(machines.DFATrans, partition.Size()),
@@ -392,21 +448,25 @@ func (dfa *DFA) minimize() *DFA {
 	for gid := 0; gid < partition.Size(); gid++ {
 		g, err := partition.Get(gid)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
 		group := g.(*set.SortedSet)
 		r, err := group.Get(0)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
 		rep := int(r.(types.Int))
 		for sym := 0; sym < 256; sym++ {
-			newdfa.Trans[gid][sym] = findGroup(dfa.Trans[rep][sym])
+			to, err := findGroup(dfa.Trans[rep][sym])
+			if err != nil {
+				return nil, err
+			}
+			newdfa.Trans[gid][sym] = to
 		}
 		if matchID, has := dfa.Accepting[rep]; has {
 			newdfa.Matches[matchID] = append(newdfa.Matches[matchID], gid)
 			newdfa.Accepting[gid] = matchID
 		}
 	}
-	return newdfa
+	return newdfa, nil
 }
@@ -1,6 +1,7 @@
 package dfa
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/timtadh/data-structures/test"
@@ -15,6 +16,22 @@ func mustParse(regex string) frontend.AST {
 	return ast
 }
 
+func mustGenerate(ast frontend.AST) *DFA {
+	dfa, err := Generate(ast)
+	if err != nil {
+		panic(err)
+	}
+	return dfa
+}
+
+func mustGenerateUnminimized(ast frontend.AST) *DFA {
+	dfa, err := GenerateUnminimized(ast)
+	if err != nil {
+		panic(err)
+	}
+	return dfa
+}
+
 func testGen(t *test.T, regex, text string, matchID int) {
 	ast, err := frontend.Parse([]byte(regex))
 	t.AssertNil(err)
@@ -22,7 +39,8 @@ func testGen(t *test.T, regex, text string, matchID int) {
 }
 
 func testGenMatch(t *test.T, ast frontend.AST, text string, matchID int) {
-	dfa := Generate(ast)
+	dfa, err := Generate(ast)
+	t.AssertNil(err)
 	t.Assert(dfa.match(text) == matchID,
 		"Expected match %d got %d for text %q.\nast: %v\n%v",
 		matchID, dfa.match(text), text, ast, dfa)
@@ -187,3 +205,23 @@ func TestGenAltMatch(x *testing.T) {
 	testGenMatch(t, ast, "f", 2)
 	testGenMatch(t, ast, "A", -1)
 }
+
+func TestGenerateUnminimized(x *testing.T) {
+	t := (*test.T)(x)
+	ast := frontend.NewAltMatch(mustParse("ab|cb"), mustParse("[0-9]+"))
+	min := mustGenerate(ast)
+	dfa := mustGenerateUnminimized(ast)
+	t.Assert(len(dfa.Trans) > len(min.Trans), "expected more states %d than %d", len(dfa.Trans), len(min.Trans))
+	for _, text := range []string{"ab", "cb", "b", "abb", "1", "12", "1b"} {
+		t.Assert(dfa.match(text) == min.match(text), "%q: %d != %d", text, dfa.match(text), min.match(text))
+	}
+}
+
+func TestDottyLabeled(x *testing.T) {
+	t := (*test.T)(x)
+	dfa := mustGenerate(frontend.NewAltMatch(mustParse("if"), mustParse("[a-z]+")))
+	dot := dfa.DottyLabeled([]string{"IF", `"ID"`})
+	t.Assert(strings.Contains(dot, `xlabel="IF"`), "missing IF label in %v", dot)
+	t.Assert(strings.Contains(dot, `xlabel="\"ID\""`), "missing ID label in %v", dot)
+	t.Assert(strings.Contains(dfa.Dotty(), `xlabel="matches 1"`), "missing match label in %v", dfa.Dotty())
+}
@@ -0,0 +1,69 @@
+package dfa
+
+import (
+	"github.com/timtadh/lexmachine/inst"
+)
+
+// Program translates the DFA into an equivalent NFA byte code program (as run
+// by machines.LexerEngine). The program starts with a JMP to the start state
+// followed by a MATCH instruction for each match-id (in order, so the n-th
+// MATCH accepts match-id n). Each state which can reach an accepting state is
+// a chain of SPLITs over its alternatives: a JMP to its MATCH when it accepts
+// and a CHAR followed by a JMP for each range of bytes with the same next
+// state.
+func (dfa *DFA) Program() inst.Slice {
+	live := dfa.live()
+	program := make(inst.Slice, 0, 1+len(dfa.Matches))
+	program = append(program, inst.New(inst.JMP, 0, 0))
+	for range dfa.Matches {
+		program = append(program, inst.New(inst.MATCH, 0, 0))
+	}
+	starts := make(map[int]uint32)
+	var jmps []*inst.Inst
+	var targets []int
+	for state := range dfa.Trans {
+		if !live[state] {
+			continue
+		}
+		var alts [][]*inst.Inst
+		if matchID, has := dfa.Accepting[state]; has {
+			alts = append(alts, []*inst.Inst{inst.New(inst.JMP, uint32(1+matchID), 0)})
+		}
+		for sym := 0; sym < 256; {
+			to := dfa.Trans[state][sym]
+			from := sym
+			for sym < 256 && dfa.Trans[state][sym] == to {
+				sym++
+			}
+			if live[to] {
+				jmp := inst.New(inst.JMP, 0, 0)
+				jmps = append(jmps, jmp)
+				targets = append(targets, to)
+				alts = append(alts, []*inst.Inst{inst.New(inst.CHAR, uint32(from), uint32(sym-1)), jmp})
+			}
+		}
+		starts[state] = uint32(len(program))
+		for i, alt := range alts {
+			var split *inst.Inst
+			if i+1 < len(alts) {
+				split = inst.New(inst.SPLIT, uint32(len(program))+1, 0)
+				program = append(program, split)
+			}
+			program = append(program, alt...)
+			if split != nil {
+				split.Y = uint32(len(program))
+			}
+		}
+	}
+	for i, jmp := range jmps {
+		jmp.X = starts[targets[i]]
+	}
+	if start, has := starts[dfa.Start]; has {
+		program[0].X = start
+	} else {
+		// nothing is accepted: jump to a byte range which is empty
+		program[0].X = uint32(len(program))
+		program = append(program, inst.New(inst.CHAR, 1, 0))
+	}
+	return program
+}
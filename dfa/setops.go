@@ -0,0 +1,374 @@
+package dfa
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/timtadh/lexmachine/frontend"
+	"github.com/timtadh/lexmachine/machines"
+)
+
+// generateSetOps generates a DFA from a regular expressions AST containing
+// set operators (which the followpos construction can not handle). The AST is
+// compiled to a Thompson NFA where each set operator is replaced by the DFA
+// for it (built with the product construction) and the NFA is then
+// determinized with the subset construction.
+func generateSetOps(root frontend.AST) *DFA {
+	n := new(enfa)
+	matches := 0
+	start, _ := n.fragment(root, &matches)
+	return n.determinize(start, matches).trim()
+}
+
+// enfa is a NFA with empty (epsilon) transitions.
+type enfa struct {
+	eps     [][]int  // the epsilon transitions of each state
+	edges   [][]edge // the byte transitions of each state
+	matches []int    // the match-id accepted by each state (-1 for none)
+}
+
+// edge is a transition on the bytes From-To (inclusive).
+type edge struct {
+	from, to byte
+	target   int
+}
+
+func (n *enfa) state() int {
+	n.eps = append(n.eps, nil)
+	n.edges = append(n.edges, nil)
+	n.matches = append(n.matches, -1)
+	return len(n.eps) - 1
+}
+
+func (n *enfa) epsilon(from, to int) {
+	n.eps[from] = append(n.eps[from], to)
+}
+
+// fragment adds the states for ast returning its start and end states. The
+// Match nodes are numbered in order by matches.
+func (n *enfa) fragment(ast frontend.AST, matches *int) (start, end int) {
+	start = n.state()
+	switch a := ast.(type) {
+	case *frontend.AltMatch:
+		end = n.alternation(start, a.A, a.B, matches)
+	case *frontend.Alternation:
+		end = n.alternation(start, a.A, a.B, matches)
+	case *frontend.Match:
+		s, e := n.fragment(a.AST, matches)
+		n.epsilon(start, s)
+		n.matches[e] = *matches
+		*matches++
+		end = e
+	case *frontend.Concat:
+		end = start
+		for _, item := range a.Items {
+			s, e := n.fragment(item, matches)
+			n.epsilon(end, s)
+			end = e
+		}
+	case *frontend.Star:
+		s, e := n.fragment(a.AST, matches)
+		end = n.state()
+		n.epsilon(start, s)
+		n.epsilon(start, end)
+		n.epsilon(e, s)
+		n.epsilon(e, end)
+	case *frontend.Plus:
+		s, e := n.fragment(a.AST, matches)
+		end = n.state()
+		n.epsilon(start, s)
+		n.epsilon(e, s)
+		n.epsilon(e, end)
+	case *frontend.Maybe:
+		s, e := n.fragment(a.AST, matches)
+		end = n.state()
+		n.epsilon(start, s)
+		n.epsilon(start, end)
+		n.epsilon(e, end)
+	case *frontend.Character:
+		end = n.state()
+		n.edges[start] = append(n.edges[start], edge{a.Char, a.Char, end})
+	case *frontend.Range:
+		end = n.state()
+		n.edges[start] = append(n.edges[start], edge{a.From, a.To, end})
+	case *frontend.EOS:
+		end = start
+	case *frontend.Intersection:
+		end = n.embed(start, product(subDFA(a.A), subDFA(a.B), func(x, y bool) bool { return x && y }))
+	case *frontend.Difference:
+		end = n.embed(start, product(subDFA(a.A), subDFA(a.B), func(x, y bool) bool { return x && !y }))
+	case *frontend.Complement:
+		end = n.embed(start, complement(subDFA(a.AST)))
+	default:
+		panic(fmt.Errorf("Unexpected type %T", a))
+	}
+	return start, end
+}
+
+func (n *enfa) alternation(start int, a, b frontend.AST, matches *int) (end int) {
+	s1, e1 := n.fragment(a, matches)
+	s2, e2 := n.fragment(b, matches)
+	end = n.state()
+	n.epsilon(start, s1)
+	n.epsilon(start, s2)
+	n.epsilon(e1, end)
+	n.epsilon(e2, end)
+	return end
+}
+
+// embed adds the states of the DFA (with a single match-id) which can reach an
+// accepting state. The DFA is entered from start. The returned end state is
+// reached from each accepting state.
+func (n *enfa) embed(start int, dfa *DFA) (end int) {
+	live := dfa.live()
+	ids := make(map[int]int)
+	for state := range dfa.Trans {
+		if live[state] {
+			ids[state] = n.state()
+		}
+	}
+	end = n.state()
+	if !live[dfa.Start] {
+		return end
+	}
+	n.epsilon(start, ids[dfa.Start])
+	for state, id := range ids {
+		if _, has := dfa.Accepting[state]; has {
+			n.epsilon(id, end)
+		}
+		for sym := 0; sym < 256; {
+			to := dfa.Trans[state][sym]
+			from := sym
+			for sym < 256 && dfa.Trans[state][sym] == to {
+				sym++
+			}
+			if live[to] {
+				n.edges[id] = append(n.edges[id], edge{byte(from), byte(sym - 1), ids[to]})
+			}
+		}
+	}
+	return end
+}
+
+// closure adds the states reachable from states by epsilon transitions. The
+// result is sorted.
+func (n *enfa) closure(states []int) []int {
+	seen := make(map[int]bool, len(states))
+	stack := make([]int, 0, len(states))
+	for _, s := range states {
+		if !seen[s] {
+			seen[s] = true
+			stack = append(stack, s)
+		}
+	}
+	closure := make([]int, 0, len(states))
+	for len(stack) > 0 {
+		s := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		closure = append(closure, s)
+		for _, t := range n.eps[s] {
+			if !seen[t] {
+				seen[t] = true
+				stack = append(stack, t)
+			}
+		}
+	}
+	sort.Ints(closure)
+	return closure
+}
+
+// determinize converts the NFA starting in start to a DFA with the subset
+// construction. The DFA's state 0 is the error state (the empty subset). When
+// a subset contains states accepting different match-ids it accepts the
+// smallest.
+func (n *enfa) determinize(start, matches int) *DFA {
+	dfa := &DFA{
+		Error:     0,
+		Matches:   make([][]int, matches),
+		Accepting: make(machines.DFAAccepting),
+		Trans:     make(machines.DFATrans, 1),
+	}
+	subsets := [][]int{nil}
+	index := map[string]int{"": 0}
+	add := func(subset []int) int {
+		parts := make([]string, 0, len(subset))
+		for _, s := range subset {
+			parts = append(parts, strconv.Itoa(s))
+		}
+		key := strings.Join(parts, ",")
+		if i, has := index[key]; has {
+			return i
+		}
+		index[key] = len(subsets)
+		subsets = append(subsets, subset)
+		dfa.Trans = append(dfa.Trans, [256]int{})
+		return len(subsets) - 1
+	}
+	dfa.Start = add(n.closure([]int{start}))
+	for i := 1; i < len(subsets); i++ {
+		var next [256][]int
+		matchID := -1
+		for _, s := range subsets[i] {
+			for _, e := range n.edges[s] {
+				for sym := int(e.from); sym <= int(e.to); sym++ {
+					next[sym] = append(next[sym], e.target)
+				}
+			}
+			if m := n.matches[s]; m >= 0 && (matchID < 0 || m < matchID) {
+				matchID = m
+			}
+		}
+		for sym := range next {
+			if len(next[sym]) > 0 {
+				to := add(n.closure(next[sym]))
+				dfa.Trans[i][sym] = to
+			}
+		}
+		if matchID >= 0 {
+			dfa.Accepting[i] = matchID
+			dfa.Matches[matchID] = append(dfa.Matches[matchID], i)
+		}
+	}
+	return dfa
+}
+
+// subDFA generates the DFA for an operand of a set operator. It accepts
+// match-id 0.
+func subDFA(ast frontend.AST) *DFA {
+	n := new(enfa)
+	matches := 0
+	start, end := n.fragment(ast, &matches)
+	n.matches[end] = 0
+	return n.determinize(start, 1)
+}
+
+// product builds the product of the DFAs a and b. A state accepts (match-id
+// 0) if accept is true for whether a and b accept in it. The DFA has no error
+// state (Error is -1).
+func product(a, b *DFA, accept func(x, y bool) bool) *DFA {
+	type pair struct{ a, b int }
+	dfa := &DFA{
+		Error:     -1,
+		Matches:   make([][]int, 1),
+		Accepting: make(machines.DFAAccepting),
+	}
+	index := make(map[pair]int)
+	pairs := make([]pair, 0, len(a.Trans)+len(b.Trans))
+	add := func(p pair) int {
+		if i, has := index[p]; has {
+			return i
+		}
+		index[p] = len(pairs)
+		pairs = append(pairs, p)
+		dfa.Trans = append(dfa.Trans, [256]int{})
+		return len(pairs) - 1
+	}
+	dfa.Start = add(pair{a.Start, b.Start})
+	for i := 0; i < len(pairs); i++ {
+		p := pairs[i]
+		for sym := 0; sym < 256; sym++ {
+			to := add(pair{a.Trans[p.a][sym], b.Trans[p.b][sym]})
+			dfa.Trans[i][sym] = to
+		}
+		_, aAccepts := a.Accepting[p.a]
+		_, bAccepts := b.Accepting[p.b]
+		if accept(aAccepts, bAccepts) {
+			dfa.Accepting[i] = 0
+			dfa.Matches[0] = append(dfa.Matches[0], i)
+		}
+	}
+	return dfa
+}
+
+// complement builds a DFA accepting (match-id 0) every string the dfa does
+// not. The DFA has no error state (Error is -1).
+func complement(dfa *DFA) *DFA {
+	c := &DFA{
+		Start:     dfa.Start,
+		Error:     -1,
+		Matches:   make([][]int, 1),
+		Accepting: make(machines.DFAAccepting),
+		Trans:     make(machines.DFATrans, len(dfa.Trans)),
+	}
+	copy(c.Trans, dfa.Trans)
+	for state := range c.Trans {
+		if _, has := dfa.Accepting[state]; !has {
+			c.Accepting[state] = 0
+			c.Matches[0] = append(c.Matches[0], state)
+		}
+	}
+	return c
+}
+
+// live computes which states can reach an accepting state.
+func (dfa *DFA) live() []bool {
+	reverse := make([][]int, len(dfa.Trans))
+	for from := range dfa.Trans {
+		for _, to := range dfa.Trans[from] {
+			reverse[to] = append(reverse[to], from)
+		}
+	}
+	live := make([]bool, len(dfa.Trans))
+	stack := make([]int, 0, len(dfa.Accepting))
+	for state := range dfa.Accepting {
+		live[state] = true
+		stack = append(stack, state)
+	}
+	for len(stack) > 0 {
+		to := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, from := range reverse[to] {
+			if !live[from] {
+				live[from] = true
+				stack = append(stack, from)
+			}
+		}
+	}
+	return live
+}
+
+// trim builds a DFA where the transitions to states which can not reach an
+// accepting state go to the error state (0) and the states which can not be
+// reached are removed.
+func (dfa *DFA) trim() *DFA {
+	live := dfa.live()
+	t := &DFA{
+		Error:     0,
+		Matches:   make([][]int, len(dfa.Matches)),
+		Accepting: make(machines.DFAAccepting),
+		Trans:     make(machines.DFATrans, 1),
+	}
+	ids := make(map[int]int)
+	states := []int{-1}
+	add := func(state int) int {
+		if !live[state] {
+			return 0
+		} else if id, has := ids[state]; has {
+			return id
+		}
+		ids[state] = len(states)
+		states = append(states, state)
+		t.Trans = append(t.Trans, [256]int{})
+		return len(states) - 1
+	}
+	t.Start = add(dfa.Start)
+	if t.Start == 0 {
+		// nothing is accepted, the start state is a (second) error state
+		t.Start = 1
+		t.Trans = append(t.Trans, [256]int{})
+	}
+	for id := 1; id < len(states); id++ {
+		state := states[id]
+		for sym, to := range dfa.Trans[state] {
+			next := add(to)
+			t.Trans[id][sym] = next
+		}
+		if matchID, has := dfa.Accepting[state]; has {
+			t.Accepting[id] = matchID
+			t.Matches[matchID] = append(t.Matches[matchID], id)
+		}
+	}
+	return t
+}
@@ -0,0 +1,94 @@
+package dfa
+
+import (
+	"testing"
+
+	"github.com/timtadh/data-structures/test"
+	"github.com/timtadh/lexmachine/frontend"
+	"github.com/timtadh/lexmachine/machines"
+)
+
+func mustParseSetOps(regex string) frontend.AST {
+	ast, err := frontend.ParseSetOps([]byte(regex))
+	if err != nil {
+		panic(err)
+	}
+	return ast
+}
+
+func testGenSetOps(t *test.T, regex, text string, matchID int) {
+	testGenMatch(t, mustParseSetOps(regex), text, matchID)
+}
+
+func TestGenIntersection(x *testing.T) {
+	t := (*test.T)(x)
+	testGenSetOps(t, "[a-z]*a[a-z]*&[a-z]*b[a-z]*", "ab", 0)
+	testGenSetOps(t, "[a-z]*a[a-z]*&[a-z]*b[a-z]*", "xbya", 0)
+	testGenSetOps(t, "[a-z]*a[a-z]*&[a-z]*b[a-z]*", "aaa", -1)
+	testGenSetOps(t, "[a-z]*a[a-z]*&[a-z]*b[a-z]*", "b", -1)
+	testGenSetOps(t, "a&b", "a", -1)
+}
+
+func TestGenDifference(x *testing.T) {
+	t := (*test.T)(x)
+	testGenSetOps(t, "[a-z]+--(if|else)", "i", 0)
+	testGenSetOps(t, "[a-z]+--(if|else)", "iff", 0)
+	testGenSetOps(t, "[a-z]+--(if|else)", "if", -1)
+	testGenSetOps(t, "[a-z]+--(if|else)", "else", -1)
+	testGenSetOps(t, "x(a*--aa)y", "xy", 0)
+	testGenSetOps(t, "x(a*--aa)y", "xaay", -1)
+	testGenSetOps(t, "x(a*--aa)y", "xaaay", 0)
+}
+
+func TestGenComplement(x *testing.T) {
+	t := (*test.T)(x)
+	testGenSetOps(t, "/~(.*ab.*)/", "//", 0)
+	testGenSetOps(t, "/~(.*ab.*)/", "/bba/", 0)
+	testGenSetOps(t, "/~(.*ab.*)/", "/aab/", -1)
+	testGenSetOps(t, "a~b", "ab", -1)
+	testGenSetOps(t, "a~b", "a", 0)
+	testGenSetOps(t, "a~b", "abb", 0)
+}
+
+func TestGenSetOpsAltMatch(x *testing.T) {
+	t := (*test.T)(x)
+	ast := frontend.NewAltMatch(
+		mustParseSetOps("if"),
+		frontend.NewAltMatch(
+			mustParseSetOps("[a-z]+--i[a-z]*"),
+			mustParseSetOps("[a-z]+"),
+		),
+	)
+	testGenMatch(t, ast, "if", 0)
+	testGenMatch(t, ast, "x", 1)
+	testGenMatch(t, ast, "ix", 2)
+	testGenMatch(t, ast, "I", -1)
+	min := mustGenerate(ast)
+	dfa := mustGenerateUnminimized(ast)
+	for _, text := range []string{"", "i", "if", "iff", "fi", "x"} {
+		t.Assert(dfa.match(text) == min.match(text), "%q: %d != %d", text, dfa.match(text), min.match(text))
+	}
+}
+
+func TestProgram(x *testing.T) {
+	t := (*test.T)(x)
+	ast := frontend.NewAltMatch(
+		mustParseSetOps("if"),
+		frontend.NewAltMatch(
+			mustParseSetOps("[a-z]+--(ab)"),
+			mustParseSetOps("a(b|c)"),
+		),
+	)
+	dfa := mustGenerate(ast)
+	program := dfa.Program()
+	for _, text := range []string{"if", "i", "ab", "ac", "abc", "a", "b"} {
+		scan := machines.LexerEngine(program, []byte(text))
+		_, m, err, _ := scan(0)
+		t.AssertNil(err)
+		t.Assert(len(m.Bytes) == len(text), "expected %q to be matched got %v", text, m)
+		t.Assert(m.PC-1 == dfa.match(text), "%q: expected match %d got %d", text, dfa.match(text), m.PC-1)
+	}
+	scan := machines.LexerEngine(mustGenerate(frontend.NewMatch(mustParseSetOps("a--a"))).Program(), []byte("a"))
+	_, _, err, _ := scan(0)
+	t.Assert(err != nil, "expected nothing to match")
+}
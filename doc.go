@@ -5,7 +5,7 @@
 // through an "escape hatch" which allows the users to consume any number of
 // further bytes after a match. So if you want to support nested C-style
 // comments or other paired structures you can do so at the lexical analysis
-// stage.
+// stage. The Nested action handles the common case of balanced delimiters.
 //
 // For a tutorial see
 // http://hackthology.com/writing-a-lexer-in-go-with-lexmachine.html
@@ -25,40 +25,11 @@
 //         }
 //
 //         lexer.Add([]byte(`//[^\n]*\n?`), token("COMMENT"))
-//         lexer.Add([]byte(`/\*([^*]|\r|\n|(\*+([^*/]|\r|\n)))*\*+/`), token("COMMENT"))
+//         lexer.AddShortest([]byte(`/\*.*\*/`), token("COMMENT"))
 //         lexer.Add([]byte(`([a-z]|[A-Z])([a-z]|[A-Z]|[0-9]|_)*`), token("ID"))
 //         lexer.Add([]byte(`"([^\\"]|(\\.))*"`), token("ID"))
 //         lexer.Add([]byte("( |\t|\n|\r)+"), skip)
-//         lexer.Add([]byte(`\<`),
-//             func(scan *lexmachine.Scanner, match *machines.Match) (interface{}, error) {
-//                 str := make([]byte, 0, 10)
-//                 str = append(str, match.Bytes...)
-//                 brackets := 1
-//                 match.EndLine = match.StartLine
-//                 match.EndColumn = match.StartColumn
-//                 for tc := scan.TC; tc < len(scan.Text); tc++ {
-//                     str = append(str, scan.Text[tc])
-//                     match.EndColumn += 1
-//                     if scan.Text[tc] == '\n' {
-//                         match.EndLine += 1
-//                     }
-//                     if scan.Text[tc] == '<' {
-//                         brackets += 1
-//                     } else if scan.Text[tc] == '>' {
-//                         brackets -= 1
-//                     }
-//                     if brackets == 0 {
-//                         match.TC = scan.TC
-//                         scan.TC = tc + 1
-//                         match.Bytes = str
-//                         return token("ID")(scan, match)
-//                     }
-//                 }
-//                 return nil,
-//                     fmt.Errorf("unclosed HTML literal starting at %d, (%d, %d)",
-//                         match.TC, match.StartLine, match.StartColumn)
-//             },
-//         )
+//         lexer.Add([]byte(`\<`), lexmachine.Nested([]byte("<"), []byte(">"), nil, token("ID")))
 //
 //         err := lexer.Compile()
 //         if err != nil {
@@ -43,17 +43,6 @@ func main() {
 }
 
 func parse(lexer *lexmachine.Lexer, fin io.Reader) (stmts []*Node, err error) {
-	defer func() {
-		if e := recover(); e != nil {
-			switch e.(type) {
-			case error:
-				err = e.(error)
-				stmts = nil
-			default:
-				panic(e)
-			}
-		}
-	}()
 	text, err := ioutil.ReadAll(fin)
 	if err != nil {
 		return nil, err
@@ -63,5 +52,8 @@ func parse(lexer *lexmachine.Lexer, fin io.Reader) (stmts []*Node, err error) {
 		return nil, err
 	}
 	yyParse(scanner)
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
 	return scanner.stmts, nil
 }
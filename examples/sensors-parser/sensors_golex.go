@@ -20,61 +20,51 @@
 package main
 
 import (
-	"fmt"
-
 	"github.com/timtadh/lexmachine"
+	"github.com/timtadh/lexmachine/goyacc"
 	"github.com/timtadh/lexmachine/machines"
 )
 
 type golex struct {
-	*lexmachine.Scanner
+	*goyacc.Lexer
 	stmts []*Node
 }
 
 // Construct a new golex from a lexer object and the text to parse.
 func newGoLex(lexer *lexmachine.Lexer, text []byte) (*golex, error) {
-	scan, err := lexer.Scanner(text)
+	ids := goyacc.TokenIDs(yyToknames[:], yyPrivate)
+	tokenID := func(tok *lexmachine.Token) int {
+		return ids[tokens[tok.Type]]
+	}
+	fill := func(lval interface{}, tok *lexmachine.Token) {
+		lval.(*yySymType).token = tok
+	}
+	l, err := goyacc.NewLexer(lexer, text, tokenID, fill)
 	if err != nil {
 		return nil, err
 	}
-	return &golex{Scanner: scan}, nil
+	return &golex{Lexer: l}, nil
 }
 
 // Lex implements yyLexer's interface for getting the next token. It returns the
 // token type as an integer. The tokens should be defined in the $parser.y file.
-// The actual number returned will be >= yyPrivate - 1 which is the range for
-// custom token names.
+// The goyacc.Lexer maps our token types into the range goyacc expects (>=
+// yyPrivate) and records lexing errors which can be retrieved with Err().
 func (g *golex) Lex(lval *yySymType) (tokenType int) {
-	s := g.Scanner
-	tok, err, eof := s.Next()
-	if err != nil {
-		g.Error(err.Error())
-	} else if eof {
-		return -1 // signals EOF to goyacc's yyParse
-	}
-	lval.token = tok.(*lexmachine.Token)
-	// To return the correct number for goyacc you must add yyPrivate - 1 to
-	// put the value into the correct range.
-	return lval.token.Type + yyPrivate - 1
+	return g.Lexer.Lex(lval)
 }
 
-// Error implements the error handling for if there is a parse error of any
-// kind. This implementation panics. There may be no better way to hand errors
-// from goyacc. I recommend you use defer ... recover() to handle this where
-// you call into the parser.
-func (l *golex) Error(message string) {
-	// is there a better way to handle this in the context of goyacc?
-	panic(fmt.Errorf(message))
+// tokens are the token names. They are the same names as the %token
+// directives in sensors.y so goyacc.TokenIDs can map them to the token types
+// generated by goyacc.
+var tokens = []string{
+	"AT", "PLUS", "STAR", "DASH", "SLASH", "BACKSLASH", "CARROT", "BACKTICK",
+	"COMMA", "LPAREN", "RPAREN", "BUS", "COMPUTE", "CHIP", "IGNORE", "LABEL",
+	"SET", "NUMBER", "NAME", "NEWLINE",
 }
 
 // newLexer constructs the lexer for you. Only call this once.
 func newLexer() *lexmachine.Lexer {
-	// build the token map from yyToknames produced by goyacc from the %token
-	// directives.
-	tokmap := make(map[string]int)
-	for id, name := range yyToknames {
-		tokmap[name] = id
-	}
 	getToken := func(tokenType int) lexmachine.Action {
 		return func(s *lexmachine.Scanner, m *machines.Match) (interface{}, error) {
 			return s.Token(tokenType, string(m.Bytes), m), nil
@@ -83,6 +73,10 @@ func newLexer() *lexmachine.Lexer {
 	skip := func(s *lexmachine.Scanner, m *machines.Match) (interface{}, error) {
 		return nil, nil
 	}
+	tokmap := make(map[string]int)
+	for id, name := range tokens {
+		tokmap[name] = id
+	}
 	var lexer = lexmachine.NewLexer()
 	lexer.Add([]byte("@"), getToken(tokmap["AT"]))
 	lexer.Add([]byte(`\+`), getToken(tokmap["PLUS"]))
@@ -0,0 +1,192 @@
+package lexmachine
+
+import (
+	"fmt"
+	"strings"
+
+	dfapkg "github.com/timtadh/lexmachine/dfa"
+	"github.com/timtadh/lexmachine/machines"
+)
+
+// Reason is why the pattern which matched a token won over the other
+// candidates.
+type Reason uint8
+
+const (
+	// OnlyCandidate means no other pattern matched any prefix of the text at
+	// the start of the token.
+	OnlyCandidate Reason = iota
+	// LongestMatch means the other candidates only matched shorter prefixes.
+	LongestMatch
+	// Priority means other patterns matched the same lexeme but the winning
+	// pattern was added to the Lexer first.
+	Priority
+	// ShortestMatch means the winning pattern was added with AddShortest and
+	// stopped the Scanner at its first match although other candidates
+	// matched longer prefixes.
+	ShortestMatch
+)
+
+func (r Reason) String() string {
+	switch r {
+	case OnlyCandidate:
+		return "only candidate"
+	case LongestMatch:
+		return "longest match"
+	case Priority:
+		return "priority"
+	case ShortestMatch:
+		return "shortest match"
+	}
+	return fmt.Sprintf("Reason(%d)", uint8(r))
+}
+
+// A Candidate is a pattern which matched a prefix of the text at the start of
+// a token.
+type Candidate struct {
+	Pattern int    // the index of the pattern (in the order added to the Lexer)
+	Regex   string // the pattern
+	Length  int    // the length of the longest prefix it matched (the shortest for AddShortest patterns)
+}
+
+// An Explanation explains how the Scanner matched a token. It is reported for
+// every match (including those whose Action returns nil) to the function
+// given to WithExplain.
+//
+// The PC of the TraceAccept events in the Path is replaced with the index of
+// the pattern accepted.
+type Explanation struct {
+	Match      *machines.Match
+	Pattern    int                   // the index of the pattern which won
+	Regex      string                // the pattern which won
+	Path       []machines.TraceEvent // the steps the engine took to find the match (see below)
+	Candidates []Candidate           // every pattern which matched a prefix of the text, longest first
+	Reason     Reason                // why Pattern won
+}
+
+// String formats the explanation for humans
+func (e *Explanation) String() string {
+	lines := make([]string, 0, len(e.Path)+len(e.Candidates)+3)
+	lines = append(lines, fmt.Sprintf("%q at %d:%d matched pattern %d %q (%v)",
+		e.Match.Bytes, e.Match.StartLine, e.Match.StartColumn, e.Pattern, e.Regex, e.Reason))
+	lines = append(lines, "  path:")
+	for _, event := range e.Path {
+		if event.Kind == machines.TraceAccept {
+			lines = append(lines, fmt.Sprintf("    accept the text up to %d as pattern %d", event.TC, event.PC))
+		} else {
+			lines = append(lines, "    "+event.String())
+		}
+	}
+	lines = append(lines, "  candidates:")
+	for _, c := range e.Candidates {
+		lines = append(lines, fmt.Sprintf("    pattern %d %q matched %d bytes", c.Pattern, c.Regex, c.Length))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// WithExplain reports an Explanation of every match the Scanner makes to
+// explain. Explaining matches is slow, it is intended for debugging lexers.
+func WithExplain(explain func(*Explanation)) ScannerOption {
+	return func(s *Scanner) {
+		s.explain = explain
+	}
+}
+
+// trace records the steps the engine takes to find the next match.
+func (s *Scanner) trace(event machines.TraceEvent) {
+	if event.Kind == machines.TraceStart {
+		s.path = s.path[:0]
+	}
+	s.path = append(s.path, event)
+}
+
+// explainMatch reports the explanation of match to s.explain.
+func (s *Scanner) explainMatch(match *machines.Match) error {
+	dfas, err := s.lexer.patternDFAs()
+	if err != nil {
+		return err
+	}
+	winner := s.matches[match.PC]
+	e := &Explanation{
+		Match:   match,
+		Pattern: winner,
+		Regex:   string(s.lexer.patterns[winner].regex),
+		Path:    append([]machines.TraceEvent(nil), s.path...),
+		Reason:  OnlyCandidate,
+	}
+	for i := range e.Path {
+		if e.Path[i].Kind == machines.TraceAccept {
+			e.Path[i].PC = s.matches[e.Path[i].PC]
+		}
+	}
+	for i, dfa := range dfas {
+		length := prefixMatch(dfa, s.Text[match.TC:], s.lexer.patterns[i].shortest)
+		if length <= 0 {
+			continue
+		}
+		e.Candidates = append(e.Candidates, Candidate{
+			Pattern: i,
+			Regex:   string(s.lexer.patterns[i].regex),
+			Length:  length,
+		})
+		if i == winner {
+			continue
+		} else if length == len(match.Bytes) {
+			e.Reason = Priority
+		} else if length > len(match.Bytes) && s.lexer.patterns[winner].shortest && e.Reason != Priority {
+			e.Reason = ShortestMatch
+		} else if e.Reason == OnlyCandidate {
+			e.Reason = LongestMatch
+		}
+	}
+	// longest first, then in priority order
+	for i := 1; i < len(e.Candidates); i++ {
+		for j := i; j > 0 && e.Candidates[j].Length > e.Candidates[j-1].Length; j-- {
+			e.Candidates[j], e.Candidates[j-1] = e.Candidates[j-1], e.Candidates[j]
+		}
+	}
+	s.explain(e)
+	return nil
+}
+
+// patternDFAs compiles (once) a DFA for each pattern on its own.
+func (c *CompiledLexer) patternDFAs() ([]*dfapkg.DFA, error) {
+	c.explainOnce.Do(func() {
+		c.explainDFAs = make([]*dfapkg.DFA, 0, len(c.patterns))
+		for _, p := range c.patterns {
+			ast, err := p.parse()
+			if err != nil {
+				c.explainErr = err
+				return
+			}
+			dfa, err := dfapkg.Generate(ast)
+			if err != nil {
+				c.explainErr = err
+				return
+			}
+			c.explainDFAs = append(c.explainDFAs, dfa)
+		}
+	})
+	return c.explainDFAs, c.explainErr
+}
+
+// prefixMatch returns the length of the longest prefix of text the dfa
+// accepts (or -1 if it accepts none). If shortest it returns the length of the
+// shortest prefix instead (as the Scanner does for AddShortest patterns).
+func prefixMatch(dfa *dfapkg.DFA, text []byte, shortest bool) int {
+	length := -1
+	state := dfa.Start
+	for tc := 0; state != dfa.Error; tc++ {
+		if _, has := dfa.Accepting[state]; has {
+			length = tc
+			if shortest {
+				break
+			}
+		}
+		if tc >= len(text) {
+			break
+		}
+		state = dfa.Trans[state][text[tc]]
+	}
+	return length
+}
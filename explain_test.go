@@ -0,0 +1,121 @@
+package lexmachine
+
+import (
+	"testing"
+
+	"github.com/timtadh/data-structures/test"
+	"github.com/timtadh/lexmachine/machines"
+)
+
+func TestExplain(x *testing.T) {
+	t := (*test.T)(x)
+	newLexer := func() *Lexer {
+		lexer := NewLexer()
+		lexer.Add([]byte(`if`), func(s *Scanner, m *machines.Match) (interface{}, error) {
+			return s.Token(0, nil, m), nil
+		})
+		lexer.Add([]byte(`[a-z]+`), func(s *Scanner, m *machines.Match) (interface{}, error) {
+			return s.Token(1, nil, m), nil
+		})
+		lexer.Add([]byte(` +`), func(*Scanner, *machines.Match) (interface{}, error) {
+			return nil, nil
+		})
+		return lexer
+	}
+	runTest := func(lexer *Lexer) {
+		explanations := make([]*Explanation, 0, 5)
+		scanner, err := lexer.Scanner([]byte("if iff i"), WithExplain(func(e *Explanation) {
+			explanations = append(explanations, e)
+		}))
+		t.AssertNil(err)
+		for _, err, eos := scanner.Next(); !eos; _, err, eos = scanner.Next() {
+			t.AssertNil(err)
+		}
+		expected := []struct {
+			lexeme     string
+			pattern    int
+			reason     Reason
+			candidates []Candidate
+		}{
+			{"if", 0, Priority, []Candidate{{0, "if", 2}, {1, "[a-z]+", 2}}},
+			{" ", 2, OnlyCandidate, []Candidate{{2, " +", 1}}},
+			{"iff", 1, LongestMatch, []Candidate{{1, "[a-z]+", 3}, {0, "if", 2}}},
+			{" ", 2, OnlyCandidate, []Candidate{{2, " +", 1}}},
+			{"i", 1, OnlyCandidate, []Candidate{{1, "[a-z]+", 1}}},
+		}
+		t.Assert(len(explanations) == len(expected), "expected %d explanations got %d", len(expected), len(explanations))
+		for i, e := range explanations {
+			ex := expected[i]
+			t.Assert(string(e.Match.Bytes) == ex.lexeme, "expected %q got %q", ex.lexeme, e.Match.Bytes)
+			t.Assert(e.Pattern == ex.pattern, "%q: expected pattern %d got %d", ex.lexeme, ex.pattern, e.Pattern)
+			t.Assert(e.Reason == ex.reason, "%q: expected %v got %v", ex.lexeme, ex.reason, e.Reason)
+			t.Assert(len(e.Candidates) == len(ex.candidates), "%q: expected %v got %v", ex.lexeme, ex.candidates, e.Candidates)
+			for j := range e.Candidates {
+				t.Assert(e.Candidates[j] == ex.candidates[j], "%q: expected %v got %v", ex.lexeme, ex.candidates, e.Candidates)
+			}
+			t.Assert(len(e.Path) > 0 && e.Path[0].Kind == machines.TraceStart && e.Path[0].TC == e.Match.TC, "%q: bad path %v", ex.lexeme, e.Path)
+			accepted := false
+			for _, event := range e.Path {
+				if event.Kind == machines.TraceAccept && event.TC == e.Match.TC+len(e.Match.Bytes) {
+					accepted = true
+				}
+			}
+			t.Assert(accepted, "%q: the path does not accept the match %v", ex.lexeme, e.Path)
+		}
+	}
+	{
+		lexer := newLexer()
+		t.AssertNil(lexer.CompileNFA())
+		runTest(lexer)
+	}
+	{
+		lexer := newLexer()
+		t.AssertNil(lexer.CompileDFA())
+		runTest(lexer)
+	}
+}
+
+func TestExplainShortest(x *testing.T) {
+	t := (*test.T)(x)
+	newLexer := func() *Lexer {
+		lexer := NewLexer()
+		lexer.AddShortest([]byte(`/\*.*\*/`), func(s *Scanner, m *machines.Match) (interface{}, error) {
+			return s.Token(0, nil, m), nil
+		})
+		lexer.Add([]byte(`[a-z/* ]+`), func(s *Scanner, m *machines.Match) (interface{}, error) {
+			return s.Token(1, nil, m), nil
+		})
+		return lexer
+	}
+	runTest := func(lexer *Lexer) {
+		explanations := make([]*Explanation, 0, 2)
+		scanner, err := lexer.Scanner([]byte("/* a */ b */"), WithExplain(func(e *Explanation) {
+			explanations = append(explanations, e)
+		}))
+		t.AssertNil(err)
+		for _, err, eos := scanner.Next(); !eos; _, err, eos = scanner.Next() {
+			t.AssertNil(err)
+		}
+		t.Assert(len(explanations) == 2, "expected 2 explanations got %d", len(explanations))
+		e := explanations[0]
+		t.Assert(string(e.Match.Bytes) == "/* a */" && e.Pattern == 0, "expected the comment got %v", e)
+		t.Assert(e.Reason == ShortestMatch, "expected %v got %v", ShortestMatch, e.Reason)
+		candidates := []Candidate{{1, "[a-z/* ]+", 12}, {0, `/\*.*\*/`, 7}}
+		t.Assert(len(e.Candidates) == len(candidates), "expected %v got %v", candidates, e.Candidates)
+		for i := range candidates {
+			t.Assert(e.Candidates[i] == candidates[i], "expected %v got %v", candidates, e.Candidates)
+		}
+		e = explanations[1]
+		t.Assert(string(e.Match.Bytes) == " b */" && e.Pattern == 1 && e.Reason == OnlyCandidate, "expected the rest got %v", e)
+	}
+	{
+		lexer := newLexer()
+		t.AssertNil(lexer.CompileNFA())
+		runTest(lexer)
+	}
+	{
+		lexer := newLexer()
+		t.AssertNil(lexer.CompileDFA())
+		runTest(lexer)
+	}
+}
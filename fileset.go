@@ -0,0 +1,16 @@
+//go:build go1.20
+// +build go1.20
+
+package lexmachine
+
+import (
+	"go/token"
+)
+
+// canRemoveFiles is true if removeFile removes files from their FileSet.
+const canRemoveFiles = true
+
+// removeFile removes a file which is no longer scanned from fset.
+func removeFile(fset *token.FileSet, file *token.File) {
+	fset.RemoveFile(file)
+}
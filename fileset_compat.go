@@ -0,0 +1,15 @@
+//go:build !go1.20
+// +build !go1.20
+
+package lexmachine
+
+import (
+	"go/token"
+)
+
+// canRemoveFiles is true if removeFile removes files from their FileSet.
+const canRemoveFiles = false
+
+// removeFile removes a file which is no longer scanned from fset. Before Go
+// 1.20 a FileSet can not remove files so it is left in place.
+func removeFile(fset *token.FileSet, file *token.File) {}
@@ -176,6 +176,69 @@ func (c *Character) String() string {
 	)
 }
 
+// Intersection matches the strings matched by both A and B
+type Intersection struct {
+	A AST
+	B AST
+}
+
+// Children returns a list of the child nodes
+func (i *Intersection) Children() []AST {
+	return []AST{i.A, i.B}
+}
+
+// String humanizes the subtree
+func (i *Intersection) String() string {
+	return fmt.Sprintf("(Intersection %v, %v)", i.A, i.B)
+}
+
+// Difference matches the strings matched by A but not by B
+type Difference struct {
+	A AST
+	B AST
+}
+
+// Children returns a list of the child nodes
+func (d *Difference) Children() []AST {
+	return []AST{d.A, d.B}
+}
+
+// String humanizes the subtree
+func (d *Difference) String() string {
+	return fmt.Sprintf("(Difference %v, %v)", d.A, d.B)
+}
+
+// Complement matches every string (including the empty string) not matched by
+// AST
+type Complement struct {
+	AST
+}
+
+// Children returns a list of the child nodes
+func (c *Complement) Children() []AST {
+	return []AST{c.AST}
+}
+
+// String humanizes the subtree
+func (c *Complement) String() string {
+	return fmt.Sprintf("(~ %v)", c.AST)
+}
+
+// HasSetOps checks if the tree contains an Intersection, Difference or
+// Complement. These can only be compiled to a DFA.
+func HasSetOps(ast AST) bool {
+	switch ast.(type) {
+	case *Intersection, *Difference, *Complement:
+		return true
+	}
+	for _, kid := range ast.Children() {
+		if HasSetOps(kid) {
+			return true
+		}
+	}
+	return false
+}
+
 // NewAltMatch creates an AltMatch
 func NewAltMatch(a, b AST) AST {
 	if a == nil || b == nil {
@@ -184,6 +247,21 @@ func NewAltMatch(a, b AST) AST {
 	return &AltMatch{a, b}
 }
 
+// NewIntersection creates an Intersection
+func NewIntersection(a, b AST) AST {
+	return &Intersection{a, b}
+}
+
+// NewDifference creates a Difference
+func NewDifference(a, b AST) AST {
+	return &Difference{a, b}
+}
+
+// NewComplement creates a Complement
+func NewComplement(ast AST) AST {
+	return &Complement{ast}
+}
+
 // NewMatch create a Match
 func NewMatch(ast AST) AST {
 	return &Match{NewConcat(ast, NewEOS())}
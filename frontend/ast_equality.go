@@ -87,3 +87,27 @@ func (e *EOS) Equals(o AST) bool {
 	}
 	return false
 }
+
+// Equals checks deep equality of the two trees
+func (i *Intersection) Equals(o AST) bool {
+	if x, is := o.(*Intersection); is {
+		return i.A.Equals(x.A) && i.B.Equals(x.B)
+	}
+	return false
+}
+
+// Equals checks deep equality of the two trees
+func (d *Difference) Equals(o AST) bool {
+	if x, is := o.(*Difference); is {
+		return d.A.Equals(x.A) && d.B.Equals(x.B)
+	}
+	return false
+}
+
+// Equals checks deep equality of the two trees
+func (c *Complement) Equals(o AST) bool {
+	if x, is := o.(*Complement); is {
+		return c.AST.Equals(x.AST)
+	}
+	return false
+}
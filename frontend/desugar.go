@@ -3,47 +3,81 @@ package frontend
 import "fmt"
 
 // DesugarRanges transform all Range nodes into Alternatives with individual characters
-func DesugarRanges(ast AST) AST {
+func DesugarRanges(ast AST) (AST, error) {
 	switch n := ast.(type) {
 	case *AltMatch:
-		return &AltMatch{A: DesugarRanges(n.A), B: DesugarRanges(n.B)}
+		return desugarPair(n.A, n.B, func(A, B AST) AST { return &AltMatch{A: A, B: B} })
 	case *Match:
-		return &Match{AST: DesugarRanges(n.AST)}
+		return desugarOne(n.AST, func(a AST) AST { return &Match{AST: a} })
 	case *Alternation:
-		return &Alternation{A: DesugarRanges(n.A), B: DesugarRanges(n.B)}
+		return desugarPair(n.A, n.B, func(A, B AST) AST { return &Alternation{A: A, B: B} })
 	case *Star:
-		return &Star{AST: DesugarRanges(n.AST)}
+		return desugarOne(n.AST, func(a AST) AST { return &Star{AST: a} })
 	case *Plus:
-		return &Plus{AST: DesugarRanges(n.AST)}
+		return desugarOne(n.AST, func(a AST) AST { return &Plus{AST: a} })
 	case *Maybe:
-		return &Maybe{AST: DesugarRanges(n.AST)}
+		return desugarOne(n.AST, func(a AST) AST { return &Maybe{AST: a} })
+	case *Intersection:
+		return desugarPair(n.A, n.B, func(A, B AST) AST { return &Intersection{A: A, B: B} })
+	case *Difference:
+		return desugarPair(n.A, n.B, func(A, B AST) AST { return &Difference{A: A, B: B} })
+	case *Complement:
+		return desugarOne(n.AST, func(a AST) AST { return &Complement{AST: a} })
 	case *Concat:
 		items := make([]AST, 0, len(n.Items))
 		for _, i := range n.Items {
-			items = append(items, DesugarRanges(i))
+			item, err := DesugarRanges(i)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
 		}
-		return &Concat{Items: items}
+		return &Concat{Items: items}, nil
 	case *Character:
-		return n
+		return n, nil
 	case *EOS:
-		return n
+		return n, nil
 	case *Range:
 		chars := make([]*Character, 0, n.To-n.From+1)
 		for i := int(n.From); i <= int(n.To); i++ {
 			chars = append(chars, NewCharacter(byte(i)))
 		}
 		if len(chars) <= 0 {
-			panic(fmt.Errorf("Empty, unmatchable range: %v", n))
+			return nil, fmt.Errorf("Empty, unmatchable range: %v", n)
 		}
 		if len(chars) == 1 {
-			return chars[0]
+			return chars[0], nil
 		}
 		alt := NewAlternation(chars[0], chars[1])
 		for i := 2; i < len(chars); i++ {
 			alt = NewAlternation(alt, chars[i])
 		}
-		return alt
+		return alt, nil
 	default:
-		panic(fmt.Errorf("Unexpected node type %T", n))
+		return nil, fmt.Errorf("Unexpected node type %T", n)
 	}
 }
+
+// desugarOne desugars the child of a node with one child and rebuilds the
+// node with mk.
+func desugarOne(a AST, mk func(AST) AST) (AST, error) {
+	a, err := DesugarRanges(a)
+	if err != nil {
+		return nil, err
+	}
+	return mk(a), nil
+}
+
+// desugarPair desugars the children of a node with two children and rebuilds
+// the node with mk.
+func desugarPair(A, B AST, mk func(A, B AST) AST) (AST, error) {
+	A, err := DesugarRanges(A)
+	if err != nil {
+		return nil, err
+	}
+	B, err = DesugarRanges(B)
+	if err != nil {
+		return nil, err
+	}
+	return mk(A, B), nil
+}
@@ -23,7 +23,7 @@ func TestParse(x *testing.T) {
 }
 
 func tMatch(program inst.Slice, text string, t *test.T) {
-	expected := []machines.Match{{len(program) - 1, 0, 1, 1, 1, len(text), []byte(text)}}
+	expected := []machines.Match{{PC: len(program) - 1, TC: 0, StartLine: 1, StartColumn: 1, EndLine: 1, EndColumn: len(text), Bytes: []byte(text)}}
 	if expected[0].EndColumn == 0 {
 		expected[0].EndColumn = 1
 	}
@@ -519,3 +519,73 @@ func TestLineComment(x *testing.T) {
 	t.Log(program)
 	tMatch(program, "// adfawefawe awe", t)
 }
+
+func TestParseErrors(x *testing.T) {
+	t := (*test.T)(x)
+	for _, regex := range []string{``, `(`, `()`, `a(`, `[]`, `[^]`, "[^\x00-\xff]", `|`, `(|)`} {
+		ast, err := Parse([]byte(regex))
+		t.Assert(err != nil, "expected %q to be an error got %v", regex, ast)
+	}
+}
+
+func TestEmptyAlternatives(x *testing.T) {
+	t := (*test.T)(x)
+	for regex, text := range map[string]string{`a|`: "a", `|a`: "a", `a||b`: "b", `a(b|)c`: "abc", `a(|b)c`: "abc"} {
+		ast, err := Parse([]byte(regex))
+		t.AssertNil(err)
+		program, err := Generate(ast)
+		t.AssertNil(err)
+		tMatch(program, text, t)
+	}
+}
+
+func TestNestedOps(x *testing.T) {
+	t := (*test.T)(x)
+	ast, err := Parse([]byte("a**b(c+)+(d*)*e"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	program, err := Generate(ast)
+	if err != nil {
+		t.Error(err)
+	}
+	t.Log(program)
+	tMatch(program, "bce", t)
+	tMatch(program, "aabccce", t)
+	tMatch(program, "abcdde", t)
+	tNoMatch(program, "be", t)
+}
+
+func TestParseSetOps(x *testing.T) {
+	t := (*test.T)(x)
+	ast, err := ParseSetOps([]byte("ab&~c*--d|e"))
+	t.AssertNil(err)
+	parsed := "(Match (Concat (Alternation (Difference (Intersection (Concat (Character a), (Character b)), (~ (* (Character c)))), (Character d)), (Character e)), (EOS)))"
+	t.Assert(ast.String() == parsed, "got %v expected %v", ast, parsed)
+	t.Assert(HasSetOps(ast), "expected set operators in %v", ast)
+
+	_, err = Generate(ast)
+	t.Assert(err != nil, "expected the set operators to be rejected")
+
+	ast, err = ParseSetOps([]byte(`\&\~\-\-a-b`))
+	t.AssertNil(err)
+	t.Assert(!HasSetOps(ast), "expected no set operators in %v", ast)
+	program, err := Generate(ast)
+	t.AssertNil(err)
+	tMatch(program, "&~--a-b", t)
+
+	for _, regex := range []string{`a&`, `&a`, `a--`, `--a`, `a&&b`, `~`, `a|~`} {
+		ast, err := ParseSetOps([]byte(regex))
+		t.Assert(err != nil, "expected %q to be an error got %v", regex, ast)
+	}
+
+	// without the set operators &, ~ and -- are ordinary characters
+	for regex, text := range map[string]string{`&&|\|\|`: "&&", `--[^\n]*`: "-- x", `~a&b--c`: "~a&b--c", `\&\~\-\-`: "&~--"} {
+		ast, err := Parse([]byte(regex))
+		t.AssertNil(err)
+		t.Assert(!HasSetOps(ast), "expected no set operators in %v", ast)
+		program, err := Generate(ast)
+		t.AssertNil(err)
+		tMatch(program, text, t)
+	}
+}
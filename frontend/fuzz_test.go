@@ -0,0 +1,43 @@
+//go:build go1.18
+// +build go1.18
+
+package frontend
+
+import (
+	"testing"
+)
+
+// FuzzParse checks every pattern Parse (or ParseSetOps) accepts can be
+// compiled (except the patterns with set operators which Generate rejects).
+func FuzzParse(f *testing.F) {
+	for _, regex := range []string{
+		`a`, `ab|c`, `(a|b)*c+d?`, `[a-z0-9_]`, `[^\n]`, `.`, `\d\s\w\D\S\W`,
+		`\\`, `\.`, `[\]]`, `[^\x00-\xff]`, `(a(b(c)))`, `[]`, `[^]`, `a**`, `(`, `)`, `a|`, `a(b|)c`, `(|)`,
+		`a&b`, `a--b`, `~a`, `\&\~\-\-`,
+	} {
+		f.Add([]byte(regex))
+	}
+	f.Fuzz(func(t *testing.T, regex []byte) {
+		check := func(ast AST) {
+			if _, err := DesugarRanges(ast); err != nil {
+				t.Fatalf("%q: parsed as %v but could not be desugared: %v", regex, ast, err)
+			}
+			if HasSetOps(ast) {
+				if _, err := Generate(ast); err == nil {
+					t.Fatalf("%q: parsed as %v with set operators but was compiled", regex, ast)
+				}
+			} else if _, err := Generate(ast); err != nil {
+				t.Fatalf("%q: parsed as %v but could not be compiled: %v", regex, ast, err)
+			}
+		}
+		if ast, err := Parse(regex); err == nil {
+			if HasSetOps(ast) {
+				t.Fatalf("%q: parsed as %v with set operators by Parse", regex, ast)
+			}
+			check(ast)
+		}
+		if ast, err := ParseSetOps(regex); err == nil {
+			check(ast)
+		}
+	})
+}
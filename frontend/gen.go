@@ -12,8 +12,13 @@ type generator struct {
 	program inst.Slice
 }
 
-// Generate an NFA program from the AST for a regular expression.
+// Generate an NFA program from the AST for a regular expression. The set
+// operators (intersection, difference and complement) can not be compiled to
+// an NFA program directly, compile the AST to a DFA instead.
 func Generate(ast AST) (inst.Slice, error) {
+	if HasSetOps(ast) {
+		return nil, fmt.Errorf("the set operators (&, -- and ~) can only be compiled to a DFA")
+	}
 	g := &generator{
 		program: make([]*inst.Inst, 0, 100),
 	}
@@ -100,8 +105,11 @@ func (g *generator) star(s *Star) (fill []*uint32) {
 }
 
 func (g *generator) plus(p *Plus) (fill []*uint32) {
+	start := uint32(len(g.program))
 	g.dofill(g.gen(p.AST))
-	return g.repeat(p.AST)
+	split := inst.New(inst.SPLIT, start, 0)
+	g.program = append(g.program, split)
+	return []*uint32{&split.Y}
 }
 
 func (g *generator) maybe(m *Maybe) (fill []*uint32) {
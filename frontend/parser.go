@@ -98,8 +98,21 @@ func LineCol(text []byte, tc int) (line int, col int) {
 
 // Parse a regular expression into an Abstract Syntax Tree (AST)
 func Parse(text []byte) (AST, error) {
+	return parse(text, false)
+}
+
+// ParseSetOps is Parse with the set operators enabled: & (intersection), --
+// (difference) and ~ (complement). In a pattern parsed with ParseSetOps the
+// characters & and ~ and the sequence -- must be escaped to be matched
+// literally. Parse treats them as ordinary characters.
+func ParseSetOps(text []byte) (AST, error) {
+	return parse(text, true)
+}
+
+func parse(text []byte, setOps bool) (AST, error) {
 	a, err := (&parser{
 		text:      text,
+		setOps:    setOps,
 		lastError: Errorf(text, 0, "unconsumed input"),
 	}).regex()
 	if err != nil {
@@ -110,6 +123,7 @@ func Parse(text []byte) (AST, error) {
 
 type parser struct {
 	text      []byte
+	setOps    bool // parse the set operators (see ParseSetOps)
 	lastError *ParseError
 }
 
@@ -130,7 +144,8 @@ func (p *parser) alternation(i int) (int, AST, *ParseError) {
 			log.Printf("exit alternation %v '%v'", i, string(p.text[i:]))
 		}()
 	}
-	i, A, err := p.atomicOps(i)
+	start := i
+	i, A, err := p.intersection(i)
 	if err != nil {
 		return i, nil, err
 	}
@@ -138,7 +153,10 @@ func (p *parser) alternation(i int) (int, AST, *ParseError) {
 	if err != nil {
 		return i, nil, err
 	}
-	return i, NewAlternation(A, B), nil
+	if A == nil && B == nil {
+		return start, nil, Errorf(p.text, start, "expected a regex")
+	}
+	return i, alternative(A, B), nil
 }
 
 func (p *parser) alternation_(i int) (int, AST, *ParseError) {
@@ -155,7 +173,7 @@ func (p *parser) alternation_(i int) (int, AST, *ParseError) {
 	if err != nil {
 		return i, nil, nil
 	}
-	i, A, err := p.atomicOps(i)
+	i, A, err := p.intersection(i)
 	if err != nil {
 		return i, nil, err
 	}
@@ -163,7 +181,57 @@ func (p *parser) alternation_(i int) (int, AST, *ParseError) {
 	if err != nil {
 		return i, nil, err
 	}
-	return i, NewAlternation(A, B), nil
+	return i, alternative(A, B), nil
+}
+
+// alternative joins the choices of an alternation. An empty choice (nil) is
+// dropped so a| and |a are both a.
+func alternative(A, B AST) AST {
+	if A == nil {
+		return B
+	}
+	return NewAlternation(A, B)
+}
+
+func (p *parser) intersection(i int) (int, AST, *ParseError) {
+	if DEBUG {
+		log.Printf("enter intersection %v '%v'", i, string(p.text[i:]))
+		defer func() {
+			log.Printf("exit intersection %v '%v'", i, string(p.text[i:]))
+		}()
+	}
+	i, A, err := p.atomicOps(i)
+	if err != nil || A == nil || !p.setOps {
+		return i, A, err
+	}
+	for i < len(p.text) {
+		var op string
+		if p.text[i] == '&' {
+			op = "&"
+		} else if p.isDifference(i) {
+			op = "--"
+		} else {
+			break
+		}
+		j, B, err := p.atomicOps(i + len(op))
+		if err != nil {
+			return j, nil, err
+		} else if B == nil {
+			return j, nil, Errorf(p.text, j, "expected a regex after '%s'", op)
+		}
+		if op == "&" {
+			A = NewIntersection(A, B)
+		} else {
+			A = NewDifference(A, B)
+		}
+		i = j
+	}
+	return i, A, nil
+}
+
+// isDifference checks if the difference operator (--) starts at i
+func (p *parser) isDifference(i int) bool {
+	return p.setOps && i+1 < len(p.text) && p.text[i] == '-' && p.text[i+1] == '-'
 }
 
 func (p *parser) atomicOps(i int) (int, AST, *ParseError) {
@@ -176,10 +244,11 @@ func (p *parser) atomicOps(i int) (int, AST, *ParseError) {
 	if i >= len(p.text) {
 		return i, nil, nil
 	}
+	start := i
 	i, A, err := p.atomicOp(i)
 	if err != nil {
 		p.lastError.Chain(err)
-		return i, nil, nil
+		return start, nil, nil
 	}
 	i, B, err := p.atomicOps(i)
 	if err != nil {
@@ -195,6 +264,15 @@ func (p *parser) atomicOp(i int) (int, AST, *ParseError) {
 			log.Printf("exit atomicOp %v '%v'", i, string(p.text[i:]))
 		}()
 	}
+	if p.setOps && i < len(p.text) && p.text[i] == '~' {
+		i, A, err := p.atomicOp(i + 1)
+		if err != nil {
+			return i, nil, err
+		} else if A == nil {
+			return i, nil, Errorf(p.text, i, "expected a regex after '~'")
+		}
+		return i, NewComplement(A), nil
+	}
 	i, A, err := p.atomic(i)
 	if DEBUG {
 		log.Printf("atomic %v", err)
@@ -346,6 +424,13 @@ func (p *parser) CHAR(i int) (int, AST, *ParseError) {
 		}
 		return i, NewCharacter(b), nil
 	}
+	if p.isDifference(i) {
+		return i, nil, Errorf(p.text, i, "unexpected operator, --")
+	}
+	if p.setOps && (p.text[i] == '&' || p.text[i] == '~') {
+		return i, nil, Errorf(p.text, i,
+			"unexpected operator, %s", string([]byte{p.text[i]}))
+	}
 	switch p.text[i] {
 	case '|', '+', '*', '?', '(', ')', '[', ']', '^':
 		return i, nil, Errorf(p.text, i,
@@ -455,6 +540,9 @@ func (p *parser) charClass(i int) (int, AST, *ParseError) {
 	if exclude {
 		ranges = invertRanges(ranges)
 	}
+	if len(ranges) == 0 {
+		return i, nil, Errorf(p.text, i, "the character class matches no characters")
+	}
 	ast := rangesToAST(ranges)
 	return i, ast, err
 }
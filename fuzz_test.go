@@ -0,0 +1,82 @@
+//go:build go1.18
+// +build go1.18
+
+package lexmachine
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/timtadh/lexmachine/machines"
+)
+
+// FuzzEngines lexes random text with lexers built from random patterns and
+// checks the NFA and DFA engines agree. The patterns are separated by NUL
+// bytes. The odd numbered patterns are added with AddSetOps.
+func FuzzEngines(f *testing.F) {
+	f.Add([]byte("[a-z]+\x00[0-9]+\x00( |\n)+"), []byte("abc 123\nx"))
+	f.Add([]byte("if\x00[a-z]+\x00 "), []byte("if iff $"))
+	f.Add([]byte("a*b\x00a"), []byte("aaab aa"))
+	f.Add([]byte(`/\*([^*]|\*+[^*/])*\*+/`+"\x00."), []byte("/* x */ y"))
+	f.Add([]byte("if\x00[a-z]+--if\x00 \x00~(.*ab.*)&.."), []byte("if iff ab xab"))
+	f.Add([]byte("--[^\n]*\x00a--b\x00&&|\\|\\|\x00~a"), []byte("-- x\nab && b||"))
+	f.Fuzz(func(t *testing.T, patterns, text []byte) {
+		if len(patterns) > 256 {
+			// the DFA construction is too slow for long patterns to fuzz
+			return
+		}
+		newLexer := func() *Lexer {
+			lexer := NewLexer()
+			for i, p := range bytes.Split(patterns, []byte{0}) {
+				typ := i
+				action := func(s *Scanner, m *machines.Match) (interface{}, error) {
+					return s.Token(typ, nil, m), nil
+				}
+				if i%2 == 1 {
+					lexer.AddSetOps(p, action)
+				} else {
+					lexer.Add(p, action)
+				}
+			}
+			return lexer
+		}
+		nfa := newLexer()
+		nfaErr := nfa.CompileNFA()
+		dfa := newLexer()
+		dfaErr := dfa.CompileDFA()
+		if (nfaErr == nil) != (dfaErr == nil) {
+			t.Fatalf("%q: the NFA compile error %v differs from the DFA compile error %v", patterns, nfaErr, dfaErr)
+		} else if nfaErr != nil {
+			return
+		}
+		nfaToks, nfaErr := scanAll(nfa, text)
+		dfaToks, dfaErr := scanAll(dfa, text)
+		if (nfaErr == nil) != (dfaErr == nil) {
+			t.Fatalf("%q on %q: the NFA error %v differs from the DFA error %v", patterns, text, nfaErr, dfaErr)
+		}
+		if len(nfaToks) != len(dfaToks) {
+			t.Fatalf("%q on %q: the NFA tokens %v differ from the DFA tokens %v", patterns, text, nfaToks, dfaToks)
+		}
+		for i := range nfaToks {
+			if !nfaToks[i].Equals(dfaToks[i]) {
+				t.Fatalf("%q on %q: the NFA tokens %v differ from the DFA tokens %v", patterns, text, nfaToks, dfaToks)
+			}
+		}
+	})
+}
+
+// scanAll scans the text up to the first error.
+func scanAll(lexer *Lexer, text []byte) ([]*Token, error) {
+	scanner, err := lexer.Scanner(text)
+	if err != nil {
+		return nil, err
+	}
+	toks := make([]*Token, 0, 10)
+	for tok, err, eos := scanner.Next(); !eos; tok, err, eos = scanner.Next() {
+		if err != nil {
+			return toks, err
+		}
+		toks = append(toks, tok.(*Token))
+	}
+	return toks, nil
+}
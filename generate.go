@@ -0,0 +1,186 @@
+package lexmachine
+
+import (
+	"fmt"
+	"math/rand"
+
+	dfapkg "github.com/timtadh/lexmachine/dfa"
+)
+
+// GeneratorConfig configures a Generator.
+type GeneratorConfig struct {
+	MinLength int    // the shortest string to generate (at least 1)
+	MaxLength int    // the longest string to generate (16 if 0)
+	Seed      int64  // the seed for Random. The same seed gives the same strings.
+	Alphabet  []byte // the bytes the strings may contain (any byte if empty)
+}
+
+// A Generator produces example strings for a pattern of a lexer. Each string
+// is lexed by the full lexer as a single token of that pattern: it matches
+// the pattern and is not claimed by a pattern with a higher priority. This is
+// useful for producing sample inputs for testing parsers.
+//
+// The Generator walks the lexer's minimized DFA. For each length it knows
+// which states can still reach a state accepting the pattern so neither
+// Random nor Enumerate ever has to backtrack. A state accepting a pattern
+// added with AddShortest ends the token so the strings never pass through
+// one.
+type Generator struct {
+	dfa      *dfapkg.DFA
+	pattern  int
+	min, max int
+	alphabet []byte
+	reach    [][]bool // reach[k][state] is true if state accepts the pattern after k more bytes
+	stop     []bool   // stop[state] is true if the scanner stops in state (it accepts a shortest pattern)
+	rand     *rand.Rand
+}
+
+// Generator creates a Generator for the pattern (the index of the pattern in
+// the order the patterns were added). See CompiledLexer.Generator.
+func (l *Lexer) Generator(pattern int, config GeneratorConfig) (*Generator, error) {
+	c, err := l.Compiled()
+	if err != nil {
+		return nil, err
+	}
+	return c.Generator(pattern, config)
+}
+
+// Generator creates a Generator for the pattern (the index of the pattern in
+// the order the patterns were added). If the lexer was compiled to an NFA a
+// DFA is built for the Generator.
+func (c *CompiledLexer) Generator(pattern int, config GeneratorConfig) (*Generator, error) {
+	if pattern < 0 || pattern >= len(c.patterns) {
+		return nil, fmt.Errorf("pattern %d does not exist (the lexer has %d patterns)", pattern, len(c.patterns))
+	}
+	dfa := c.dfa
+	if dfa == nil {
+		ast, err := assembleAST(c.patterns)
+		if err != nil {
+			return nil, err
+		}
+		dfa, err = dfapkg.Generate(ast)
+		if err != nil {
+			return nil, err
+		}
+	}
+	g := &Generator{
+		dfa:      dfa,
+		pattern:  pattern,
+		min:      config.MinLength,
+		max:      config.MaxLength,
+		alphabet: config.Alphabet,
+		rand:     rand.New(rand.NewSource(config.Seed)),
+	}
+	if g.min < 1 {
+		g.min = 1
+	}
+	if g.max == 0 {
+		g.max = 16
+	}
+	if g.max < g.min {
+		return nil, fmt.Errorf("the maximum length %d is less than the minimum length %d", g.max, g.min)
+	}
+	if len(g.alphabet) == 0 {
+		g.alphabet = make([]byte, 256)
+		for i := range g.alphabet {
+			g.alphabet[i] = byte(i)
+		}
+	}
+	g.stop = make([]bool, len(dfa.Trans))
+	for state, mid := range dfa.Accepting {
+		g.stop[state] = c.patterns[mid].shortest
+	}
+	g.computeReach()
+	return g, nil
+}
+
+// computeReach fills in the reach table up to the maximum length.
+func (g *Generator) computeReach() {
+	states := len(g.dfa.Trans)
+	g.reach = make([][]bool, g.max+1)
+	g.reach[0] = make([]bool, states)
+	for state, mid := range g.dfa.Accepting {
+		g.reach[0][state] = mid == g.pattern
+	}
+	for k := 1; k <= g.max; k++ {
+		g.reach[k] = make([]bool, states)
+		for state := range g.dfa.Trans {
+			if state == g.dfa.Error || g.stop[state] {
+				continue
+			}
+			for _, b := range g.alphabet {
+				if g.reach[k-1][g.dfa.Trans[state][b]] {
+					g.reach[k][state] = true
+					break
+				}
+			}
+		}
+	}
+}
+
+// Random generates a random string. The length is chosen uniformly from the
+// lengths (within the bounds) which have a string and each byte uniformly
+// from the bytes which can still complete a string of that length. It returns
+// an error if there is no string within the bounds.
+func (g *Generator) Random() ([]byte, error) {
+	lengths := make([]int, 0, g.max-g.min+1)
+	for length := g.min; length <= g.max; length++ {
+		if g.reach[length][g.dfa.Start] {
+			lengths = append(lengths, length)
+		}
+	}
+	if len(lengths) == 0 {
+		return nil, fmt.Errorf("pattern %d has no strings of length %d to %d", g.pattern, g.min, g.max)
+	}
+	length := lengths[g.rand.Intn(len(lengths))]
+	text := make([]byte, 0, length)
+	choices := make([]byte, 0, len(g.alphabet))
+	state := g.dfa.Start
+	for k := length; k > 0; k-- {
+		choices = choices[:0]
+		for _, b := range g.alphabet {
+			if g.reach[k-1][g.dfa.Trans[state][b]] {
+				choices = append(choices, b)
+			}
+		}
+		b := choices[g.rand.Intn(len(choices))]
+		text = append(text, b)
+		state = g.dfa.Trans[state][b]
+	}
+	return text, nil
+}
+
+// Enumerate returns up to n strings in order of length and then by bytes (in
+// the order of the alphabet). A pattern may have a very large number of
+// strings (exponential in MaxLength) so n must be given. It is an error for
+// n to be negative.
+func (g *Generator) Enumerate(n int) ([][]byte, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("can not enumerate %d strings", n)
+	}
+	strs := make([][]byte, 0, 10)
+	if n == 0 {
+		return strs, nil
+	}
+	var walk func(state int, text []byte, k int) bool
+	walk = func(state int, text []byte, k int) bool {
+		if k == 0 {
+			strs = append(strs, append([]byte(nil), text...))
+			return len(strs) < n
+		}
+		for _, b := range g.alphabet {
+			next := g.dfa.Trans[state][b]
+			if g.reach[k-1][next] && !walk(next, append(text, b), k-1) {
+				return false
+			}
+		}
+		return true
+	}
+	text := make([]byte, 0, g.max)
+	for length := g.min; length <= g.max; length++ {
+		if g.reach[length][g.dfa.Start] && !walk(g.dfa.Start, text, length) {
+			break
+		}
+	}
+	return strs, nil
+}
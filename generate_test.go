@@ -0,0 +1,148 @@
+package lexmachine
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/timtadh/data-structures/test"
+	"github.com/timtadh/lexmachine/machines"
+)
+
+func TestGenerator(x *testing.T) {
+	t := (*test.T)(x)
+	patterns := []string{`if`, `[a-z]+`, `[0-9]+(\.[0-9]+)?`, `"([^"\\]|\\.)*"`, `( |\t|\n)+`}
+	newLexer := func() *Lexer {
+		lexer := NewLexer()
+		for i, p := range patterns {
+			typ := i
+			lexer.Add([]byte(p), func(s *Scanner, m *machines.Match) (interface{}, error) {
+				return s.Token(typ, nil, m), nil
+			})
+		}
+		return lexer
+	}
+	// lexesAs checks the text is lexed as a single token of the pattern
+	lexesAs := func(lexer *Lexer, text []byte, pattern int) {
+		scanner, err := lexer.Scanner(text)
+		t.AssertNil(err)
+		tok, err, eos := scanner.Next()
+		t.AssertNil(err)
+		t.Assert(!eos, "expected a token for %q", text)
+		t.Assert(tok.(*Token).Type == pattern, "%q: expected pattern %d got %v", text, pattern, tok)
+		t.Assert(len(tok.(*Token).Lexeme) == len(text), "%q: expected a single token got %v", text, tok)
+	}
+	runTest := func(lexer *Lexer) {
+		for pattern := range patterns {
+			g, err := lexer.Generator(pattern, GeneratorConfig{MinLength: 1, MaxLength: 10, Seed: 42})
+			t.AssertNil(err)
+			for i := 0; i < 100; i++ {
+				text, err := g.Random()
+				t.AssertNil(err)
+				t.Assert(1 <= len(text) && len(text) <= 10, "%q: bad length", text)
+				lexesAs(lexer, text, pattern)
+			}
+			alphabet := []byte(" 1.a\"fiz\\")
+			g, err = lexer.Generator(pattern, GeneratorConfig{MaxLength: 4, Alphabet: alphabet})
+			t.AssertNil(err)
+			texts, err := g.Enumerate(50)
+			t.AssertNil(err)
+			for _, text := range texts {
+				lexesAs(lexer, text, pattern)
+			}
+		}
+	}
+	{
+		lexer := newLexer()
+		t.AssertNil(lexer.CompileNFA())
+		runTest(lexer)
+	}
+	{
+		lexer := newLexer()
+		t.AssertNil(lexer.CompileDFA())
+		runTest(lexer)
+	}
+}
+
+func TestGeneratorShortest(x *testing.T) {
+	t := (*test.T)(x)
+	newLexer := func() *Lexer {
+		lexer := NewLexer()
+		lexer.AddShortest([]byte(`/\*.*\*/`), func(s *Scanner, m *machines.Match) (interface{}, error) {
+			return s.Token(0, nil, m), nil
+		})
+		lexer.Add([]byte(`[a-z/* ]+`), func(s *Scanner, m *machines.Match) (interface{}, error) {
+			return s.Token(1, nil, m), nil
+		})
+		return lexer
+	}
+	runTest := func(lexer *Lexer) {
+		for pattern := 0; pattern < 2; pattern++ {
+			g, err := lexer.Generator(pattern, GeneratorConfig{MaxLength: 8, Seed: 42, Alphabet: []byte("a/* ")})
+			t.AssertNil(err)
+			texts, err := g.Enumerate(1 << 17) // all of them
+			t.AssertNil(err)
+			for i := 0; i < 100; i++ {
+				text, err := g.Random()
+				t.AssertNil(err)
+				texts = append(texts, text)
+			}
+			for _, text := range texts {
+				scanner, err := lexer.Scanner(text)
+				t.AssertNil(err)
+				tok, err, eos := scanner.Next()
+				t.AssertNil(err)
+				t.Assert(!eos, "expected a token for %q", text)
+				t.Assert(tok.(*Token).Type == pattern, "%q: expected pattern %d got %v", text, pattern, tok)
+				t.Assert(len(tok.(*Token).Lexeme) == len(text), "%q: expected a single token got %v", text, tok)
+			}
+		}
+	}
+	{
+		lexer := newLexer()
+		t.AssertNil(lexer.CompileNFA())
+		runTest(lexer)
+	}
+	{
+		lexer := newLexer()
+		t.AssertNil(lexer.CompileDFA())
+		runTest(lexer)
+	}
+}
+
+func TestGeneratorEnumerate(x *testing.T) {
+	t := (*test.T)(x)
+	lexer := NewLexer()
+	lexer.Add([]byte(`ab`), func(s *Scanner, m *machines.Match) (interface{}, error) { return nil, nil })
+	lexer.Add([]byte(`[ab]+`), func(s *Scanner, m *machines.Match) (interface{}, error) { return nil, nil })
+	g, err := lexer.Generator(1, GeneratorConfig{MaxLength: 2})
+	t.AssertNil(err)
+	strs, err := g.Enumerate(10)
+	t.AssertNil(err)
+	t.Assert(fmt.Sprintf("%q", strs) == `["a" "b" "aa" "ba" "bb"]`, "got %q", strs)
+	strs, err = g.Enumerate(2)
+	t.AssertNil(err)
+	t.Assert(len(strs) == 2, "expected 2 strings")
+	_, err = g.Enumerate(-1)
+	t.Assert(err != nil, "expected an error for a negative count")
+
+	// the same seed gives the same strings
+	g1, err := lexer.Generator(1, GeneratorConfig{MaxLength: 30, Seed: 7})
+	t.AssertNil(err)
+	g2, err := lexer.Generator(1, GeneratorConfig{MaxLength: 30, Seed: 7})
+	t.AssertNil(err)
+	for i := 0; i < 10; i++ {
+		a, err := g1.Random()
+		t.AssertNil(err)
+		b, err := g2.Random()
+		t.AssertNil(err)
+		t.Assert(bytes.Equal(a, b), "%q != %q", a, b)
+	}
+
+	g, err = lexer.Generator(0, GeneratorConfig{MinLength: 3, MaxLength: 5})
+	t.AssertNil(err)
+	_, err = g.Random()
+	t.Assert(err != nil, "expected an error as ab has no strings of length 3 to 5")
+	_, err = lexer.Generator(2, GeneratorConfig{})
+	t.Assert(err != nil, "expected an error for a missing pattern")
+}
@@ -0,0 +1,190 @@
+// Package goyacc adapts a lexmachine Scanner to the yyLexer interface which
+// parsers generated by goyacc expect:
+//
+//     type yyLexer interface {
+//         Lex(lval *yySymType) (tokenType int)
+//         Error(message string)
+//     }
+//
+// As yySymType is a type generated into your package the adapter cannot
+// implement Lex directly. Instead embed a *goyacc.Lexer in a small struct and
+// forward Lex to it:
+//
+//     type golex struct {
+//         *goyacc.Lexer
+//     }
+//
+//     func (g *golex) Lex(lval *yySymType) int {
+//         return g.Lexer.Lex(lval)
+//     }
+//
+//     func newGoLex(lexer *lexmachine.Lexer, text []byte) (*golex, error) {
+//         ids := goyacc.TokenIDs(yyToknames[:], yyPrivate)
+//         tokenID := func(tok *lexmachine.Token) int {
+//             return ids[tokens[tok.Type]]
+//         }
+//         fill := func(lval interface{}, tok *lexmachine.Token) {
+//             lval.(*yySymType).token = tok
+//         }
+//         l, err := goyacc.NewLexer(lexer, text, tokenID, fill)
+//         if err != nil {
+//             return nil, err
+//         }
+//         return &golex{l}, nil
+//     }
+//
+// The Error method records errors (both syntax errors reported by the parser
+// and lexing errors such as machines.UnconsumedInput) along with the position
+// of the last token. After yyParse returns check Err to see if the parse
+// failed.
+package goyacc
+
+import (
+	"fmt"
+
+	"github.com/timtadh/lexmachine"
+	"github.com/timtadh/lexmachine/machines"
+)
+
+// EOF is the token type returned by Lex at the end of the input. goyacc
+// treats any token type <= 0 as the end of the input.
+const EOF = 0
+
+// TokenID maps a token produced by the lexer's Actions to the token type
+// goyacc expects (the constants generated from the %token directives).
+type TokenID func(tok *lexmachine.Token) int
+
+// Fill stores a token into the value (a *yySymType) the parser passed to Lex.
+type Fill func(lval interface{}, tok *lexmachine.Token)
+
+// Error is an error reported either by the parser (through Lexer.Error) or by
+// the scanner. It records where in the text the error occurred.
+type Error struct {
+	Message string
+	TC      int
+	Line    int
+	Column  int
+	Err     error // the lexing error which caused this error (may be nil)
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+// Lexer implements the Lex and Error methods of goyacc's yyLexer interface on
+// top of a lexmachine Scanner. See the package documentation for how to use
+// it with the generated parser.
+type Lexer struct {
+	scanner *lexmachine.Scanner
+	tokenID TokenID
+	fill    Fill
+	last    *lexmachine.Token
+	errors  []*Error
+}
+
+// TokenIDs builds a map from token names to the token types goyacc generated
+// for them. Pass the yyToknames and yyPrivate definitions from the generated
+// parser.
+func TokenIDs(yyToknames []string, yyPrivate int) map[string]int {
+	ids := make(map[string]int, len(yyToknames))
+	for i, name := range yyToknames {
+		ids[name] = i + yyPrivate - 1
+	}
+	return ids
+}
+
+// NewLexer constructs a Lexer which scans text with lexer. The Actions of
+// lexer must produce *lexmachine.Token values (or nil to skip a match).
+func NewLexer(lexer *lexmachine.Lexer, text []byte, tokenID TokenID, fill Fill) (*Lexer, error) {
+	scanner, err := lexer.Scanner(text)
+	if err != nil {
+		return nil, err
+	}
+	return &Lexer{
+		scanner: scanner,
+		tokenID: tokenID,
+		fill:    fill,
+	}, nil
+}
+
+// Scanner returns the underlying scanner.
+func (l *Lexer) Scanner() *lexmachine.Scanner {
+	return l.scanner
+}
+
+// Lex gets the next token, stores it in lval using the Fill function and
+// returns its goyacc token type. When the scanner fails to match the input the
+// failure is recorded as an error, the unmatched text is skipped, and lexing
+// continues so the parser can attempt to recover. Any other error from the
+// scanner is recorded and ends the input.
+func (l *Lexer) Lex(lval interface{}) int {
+	for {
+		tok, err, eos := l.scanner.Next()
+		if ui, is := err.(*machines.UnconsumedInput); ui != nil && is {
+			l.errors = append(l.errors, &Error{
+				Message: ui.Error(),
+				TC:      ui.StartTC,
+				Line:    ui.StartLine,
+				Column:  ui.StartColumn,
+				Err:     ui,
+			})
+			l.scanner.TC = ui.FailTC
+			continue
+		} else if err != nil {
+			l.errorAt(err.Error(), err)
+			return EOF
+		} else if eos {
+			return EOF
+		}
+		token, is := tok.(*lexmachine.Token)
+		if !is {
+			l.errorAt(fmt.Sprintf("expected a *lexmachine.Token got %T", tok), nil)
+			return EOF
+		}
+		l.last = token
+		l.fill(lval, token)
+		return l.tokenID(token)
+	}
+}
+
+// Error records an error reported by the parser at the position of the last
+// token returned by Lex (or at the position of the scanner if Lex has not
+// returned a token).
+func (l *Lexer) Error(message string) {
+	l.errorAt(message, nil)
+}
+
+func (l *Lexer) errorAt(message string, err error) {
+	e := &Error{
+		Message: message,
+		TC:      l.scanner.TC,
+		Err:     err,
+	}
+	if l.last != nil {
+		e.TC = l.last.TC
+		e.Line = l.last.StartLine
+		e.Column = l.last.StartColumn
+	} else {
+		e.Line, e.Column = l.scanner.LineCol(e.TC)
+	}
+	l.errors = append(l.errors, e)
+}
+
+// Last returns the last token returned by Lex (or nil).
+func (l *Lexer) Last() *lexmachine.Token {
+	return l.last
+}
+
+// Errors returns all of the errors recorded so far.
+func (l *Lexer) Errors() []*Error {
+	return l.errors
+}
+
+// Err returns the first error recorded (or nil if there were no errors).
+func (l *Lexer) Err() error {
+	if len(l.errors) == 0 {
+		return nil
+	}
+	return l.errors[0]
+}
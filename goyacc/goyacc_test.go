@@ -0,0 +1,98 @@
+package goyacc
+
+import (
+	"testing"
+
+	"github.com/timtadh/data-structures/test"
+	"github.com/timtadh/lexmachine"
+	"github.com/timtadh/lexmachine/machines"
+)
+
+type symType struct {
+	token *lexmachine.Token
+}
+
+const private = 57344
+
+var toknames = []string{"$end", "error", "$unk", "NAME", "NUMBER"}
+var tokens = []string{"NAME", "NUMBER"}
+
+func newLexer(t *test.T, text string) *Lexer {
+	token := func(typ int) lexmachine.Action {
+		return func(s *lexmachine.Scanner, m *machines.Match) (interface{}, error) {
+			return s.Token(typ, string(m.Bytes), m), nil
+		}
+	}
+	lexer := lexmachine.NewLexer()
+	lexer.Add([]byte(`[a-z]+`), token(0))
+	lexer.Add([]byte(`[0-9]+`), token(1))
+	lexer.Add([]byte(`( |\n)+`), func(*lexmachine.Scanner, *machines.Match) (interface{}, error) {
+		return nil, nil
+	})
+	ids := TokenIDs(toknames, private)
+	l, err := NewLexer(lexer, []byte(text),
+		func(tok *lexmachine.Token) int {
+			return ids[tokens[tok.Type]]
+		},
+		func(lval interface{}, tok *lexmachine.Token) {
+			lval.(*symType).token = tok
+		},
+	)
+	t.AssertNil(err)
+	return l
+}
+
+func TestLex(x *testing.T) {
+	t := (*test.T)(x)
+	l := newLexer(t, "abc 12\nde")
+	expected := []struct {
+		typ    int
+		lexeme string
+	}{
+		{private + 2, "abc"},
+		{private + 3, "12"},
+		{private + 2, "de"},
+	}
+	for _, e := range expected {
+		var lval symType
+		typ := l.Lex(&lval)
+		t.Assert(typ == e.typ, "expected %d got %d", e.typ, typ)
+		t.Assert(string(lval.token.Lexeme) == e.lexeme, "expected %q got %q", e.lexeme, lval.token.Lexeme)
+	}
+	var lval symType
+	t.Assert(l.Lex(&lval) == EOF, "expected EOF")
+	t.AssertNil(l.Err())
+}
+
+func TestErrors(x *testing.T) {
+	t := (*test.T)(x)
+	l := newLexer(t, "abc $ 12\nde")
+	var lval symType
+	t.Assert(l.Lex(&lval) == private+2, "expected NAME")
+	t.Assert(l.Lex(&lval) == private+3, "expected NUMBER after skipping unmatched input")
+	t.Assert(len(l.Errors()) == 1, "expected 1 error got %v", l.Errors())
+	e := l.Errors()[0]
+	t.Assert(e.Line == 1 && e.Column == 5, "bad position %d:%d", e.Line, e.Column)
+	_, is := e.Err.(*machines.UnconsumedInput)
+	t.Assert(is, "expected UnconsumedInput got %T", e.Err)
+
+	t.Assert(l.Lex(&lval) == private+2, "expected NAME")
+	l.Error("syntax error")
+	t.Assert(len(l.Errors()) == 2, "expected 2 errors got %v", l.Errors())
+	t.Assert(l.Errors()[1].Error() == "2:1: syntax error", "got %q", l.Errors()[1].Error())
+	t.Assert(l.Err() == e, "Err should return the first error")
+}
+
+func TestErrorsBeforeTokens(x *testing.T) {
+	t := (*test.T)(x)
+	l := newLexer(t, " \n  ")
+	var lval symType
+	t.Assert(l.Lex(&lval) == EOF, "expected EOF")
+	l.Error("unexpected end of input")
+	e := l.Errors()[0]
+	t.Assert(e.TC == 4 && e.Line == 2 && e.Column == 3, "bad position %d %d:%d", e.TC, e.Line, e.Column)
+
+	l = newLexer(t, "abc")
+	l.Error("empty")
+	t.Assert(l.Errors()[0].Error() == "1:1: empty", "got %q", l.Errors()[0].Error())
+}
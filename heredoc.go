@@ -0,0 +1,231 @@
+package lexmachine
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/timtadh/lexmachine/machines"
+)
+
+// HeredocConfig configures the Action created by Heredoc.
+type HeredocConfig struct {
+	// Terminator computes the text ending the region from the text matched
+	// by the pattern starting it (required).
+	Terminator func(open []byte) []byte
+
+	// Lines makes the terminator a line of its own (as in a shell heredoc).
+	// The body starts on the line after the match and ends before the first
+	// line holding only the terminator. The match is not extended: the
+	// scanner goes on lexing the rest of the line (so `cat <<EOF | wc` gives
+	// the tokens of `| wc`) and skips the body and the terminator when it
+	// reaches the end of the line. The bodies of several heredocs opened on
+	// the same line follow each other. Without Lines the body ends at the
+	// first occurrence of the terminator after the match and the match is
+	// extended over it.
+	Lines bool
+
+	// StripIndent removes the leading spaces and tabs common to the lines of
+	// the body. With Lines the terminator may then be indented too.
+	StripIndent bool
+}
+
+// A BodyAction is called by the Action created by Heredoc with the match
+// extended over the whole region (including the terminator, unless the
+// region was found with Lines), the body of the region and the position of
+// the body in the text. bodyMatch is a match of the text of the body (before
+// StripIndent) with the PC of match: it locates the body for diagnostics or
+// highlighting. An empty body is an empty match at the start of the
+// terminator's line (or of the terminator).
+type BodyAction func(scan *Scanner, match *machines.Match, body []byte, bodyMatch *machines.Match) (interface{}, error)
+
+// Heredoc creates an Action for regions whose terminator depends on the text
+// which opened them, such as shell heredocs, Rust raw strings and Lua long
+// brackets. Add it with a pattern matching the opening of the region. The
+// terminator computed from the match is searched for after it, the match is
+// extended over the region (see Scanner.ExtendMatch) and passed to action
+// with the body of the region (with Lines the match is left alone and the
+// body is skipped at the end of the line). If the text ends first an
+// *UnterminatedError is returned. For example:
+//
+//     // Lua long brackets: [==[ ... ]==]
+//     lexer.Add([]byte(`\[=*\[`), lexmachine.Heredoc(lexmachine.HeredocConfig{
+//         Terminator: func(open []byte) []byte {
+//             return []byte("]" + strings.Repeat("=", len(open)-2) + "]")
+//         },
+//     }, str))
+//
+//     // shell heredocs: <<EOF ... EOF (and <<-EOF with indentation)
+//     lexer.Add([]byte(`<<-?[A-Za-z_]+`), lexmachine.Heredoc(lexmachine.HeredocConfig{
+//         Terminator: func(open []byte) []byte {
+//             return bytes.TrimLeft(open, "<-")
+//         },
+//         Lines:       true,
+//         StripIndent: true,
+//     }, str))
+//
+// The body is a slice of the text unless StripIndent changes it.
+func Heredoc(config HeredocConfig, action BodyAction) Action {
+	if config.Terminator == nil {
+		panic(fmt.Errorf("Heredoc requires a Terminator"))
+	}
+	return func(scan *Scanner, match *machines.Match) (interface{}, error) {
+		terminator := config.Terminator(match.Bytes)
+		var bodyStart, bodyEnd, end int
+		var found bool
+		var err error
+		if config.Lines {
+			from := scan.TC
+			if scan.deferred != nil {
+				// the body follows the bodies already deferred
+				from = scan.deferred.end
+			}
+			bodyStart, bodyEnd, end, found, err = config.findLine(scan, from, terminator)
+			if err != nil {
+				return nil, err
+			}
+		} else if i := bytes.Index(scan.Text[scan.TC:], terminator); i >= 0 {
+			bodyStart, bodyEnd, end, found = scan.TC, scan.TC+i, scan.TC+i+len(terminator), true
+		}
+		if !found {
+			return nil, &UnterminatedError{
+				Open:        match.Bytes,
+				Close:       terminator,
+				Depth:       1,
+				StartTC:     match.TC,
+				StartLine:   match.StartLine,
+				StartColumn: match.StartColumn,
+				StartPos:    match.Pos,
+			}
+		}
+		bodyMatch := scan.region(match.PC, bodyStart, bodyEnd)
+		body := bodyMatch.Bytes
+		if config.StripIndent {
+			body = stripIndent(body)
+		}
+		if config.Lines {
+			scan.deferBody(bodyStart, end)
+		} else if err := scan.ExtendMatch(match, end); err != nil {
+			return nil, err
+		}
+		return action(scan, match, body, bodyMatch)
+	}
+}
+
+// region creates a match of the text from start to end (exclusive) with the
+// positions computed by the lexing engine's line and column tables. An empty
+// region ends where it starts.
+func (s *Scanner) region(pc, start, end int) *machines.Match {
+	m := &machines.Match{
+		PC:    pc,
+		TC:    start,
+		Bytes: s.Text[start:end],
+		Pos:   s.pos(start),
+	}
+	m.StartLine, m.StartColumn = s.config.Buffers.LineCol(start)
+	m.EndLine, m.EndColumn = m.StartLine, m.StartColumn
+	if end > start {
+		m.EndLine, m.EndColumn = s.config.Buffers.LineCol(end - 1)
+	}
+	return m
+}
+
+// deferral holds the heredoc bodies deferred to the end of the line by
+// HeredocConfig.Lines. Until the scanner reaches start (the start of the
+// line after the match) it uses an engine which only sees the text before
+// start so no token runs into the bodies. It then skips to end.
+type deferral struct {
+	start, end int
+	config     machines.Config
+	scan       machines.Scanner
+}
+
+// deferBody defers the body text[start:end] of a heredoc to the end of the
+// line (or adds it to the bodies already deferred).
+func (s *Scanner) deferBody(start, end int) {
+	// the action examined the text up to the end of the terminator
+	if end+1 > s.call.lookahead {
+		s.call.lookahead = end + 1
+	}
+	if s.deferred != nil {
+		s.deferred.end = end
+		return
+	}
+	d := &deferral{start: start, end: end, config: s.config}
+	d.config.Buffers = s.config.Buffers.Fork()
+	d.scan = s.engine(s.Text[:start], &d.config)
+	s.deferred = d
+}
+
+// skipDeferred moves the scanner over the deferred heredoc bodies once it
+// reaches the end of their line.
+func (s *Scanner) skipDeferred() {
+	if s.deferred == nil || s.TC < s.deferred.start {
+		return
+	}
+	if s.TC < s.deferred.end {
+		s.TC = s.deferred.end
+	}
+	s.deferred = nil
+}
+
+// findLine finds the first line after the line holding tc which only holds the
+// terminator. The body is the text between them and the region ends after
+// the terminator (before its line ending). The search stops with an error
+// when the scan is canceled.
+func (c *HeredocConfig) findLine(scan *Scanner, tc int, terminator []byte) (bodyStart, bodyEnd, end int, found bool, err error) {
+	text := scan.Text
+	i := bytes.IndexByte(text[tc:], '\n')
+	if i < 0 {
+		return 0, 0, 0, false, nil
+	}
+	bodyStart = tc + i + 1
+	for start, n := bodyStart, 1; start < len(text); n++ {
+		if n%machines.InterruptInterval == 0 {
+			if err := scan.interrupt(); err != nil {
+				return 0, 0, 0, false, err
+			}
+		}
+		stop := len(text)
+		if j := bytes.IndexByte(text[start:], '\n'); j >= 0 {
+			stop = start + j
+		}
+		line := bytes.TrimSuffix(text[start:stop], []byte("\r"))
+		end = start + len(line)
+		if c.StripIndent {
+			line = bytes.TrimLeft(line, " \t")
+		}
+		if bytes.Equal(line, terminator) {
+			return bodyStart, start, end, true, nil
+		}
+		start = stop + 1
+	}
+	return 0, 0, 0, false, nil
+}
+
+// stripIndent removes the leading spaces and tabs common to the lines of body
+// which hold more than whitespace.
+func stripIndent(body []byte) []byte {
+	lines := bytes.SplitAfter(body, []byte("\n"))
+	indent := -1
+	for _, line := range lines {
+		content := bytes.TrimLeft(line, " \t")
+		if len(bytes.TrimSpace(content)) == 0 {
+			continue
+		}
+		if n := len(line) - len(content); indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	if indent <= 0 {
+		return body
+	}
+	stripped := make([]byte, 0, len(body))
+	for _, line := range lines {
+		n := len(line) - len(bytes.TrimLeft(line, " \t"))
+		if n > indent {
+			n = indent
+		}
+		stripped = append(stripped, line[n:]...)
+	}
+	return stripped
+}
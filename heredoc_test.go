@@ -0,0 +1,213 @@
+package lexmachine
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/timtadh/data-structures/test"
+	"github.com/timtadh/lexmachine/machines"
+)
+
+func TestHeredoc(x *testing.T) {
+	t := (*test.T)(x)
+	// the value of a heredoc token is its body and the position of the body
+	body := func(typ int) BodyAction {
+		return func(s *Scanner, m *machines.Match, body []byte, bodyMatch *machines.Match) (interface{}, error) {
+			at := fmt.Sprintf("%d (%d, %d)-(%d, %d)", bodyMatch.TC, bodyMatch.StartLine, bodyMatch.StartColumn, bodyMatch.EndLine, bodyMatch.EndColumn)
+			return s.Token(typ, [2]string{string(body), at}, m), nil
+		}
+	}
+	newLexer := func() *Lexer {
+		lexer := NewLexer()
+		// Lua long brackets
+		lexer.Add([]byte(`\[=*\[`), Heredoc(HeredocConfig{
+			Terminator: func(open []byte) []byte {
+				return []byte("]" + strings.Repeat("=", len(open)-2) + "]")
+			},
+		}, body(0)))
+		// Rust raw strings
+		lexer.Add([]byte(`r#*"`), Heredoc(HeredocConfig{
+			Terminator: func(open []byte) []byte {
+				return []byte(`"` + strings.Repeat("#", len(open)-2))
+			},
+		}, body(1)))
+		// shell heredocs
+		lexer.Add([]byte(`<<[A-Z]+`), Heredoc(HeredocConfig{
+			Terminator: func(open []byte) []byte {
+				return bytes.TrimPrefix(open, []byte("<<"))
+			},
+			Lines: true,
+		}, body(2)))
+		lexer.Add([]byte(`<<\~[A-Z]+`), Heredoc(HeredocConfig{
+			Terminator: func(open []byte) []byte {
+				return bytes.TrimPrefix(open, []byte("<<~"))
+			},
+			Lines:       true,
+			StripIndent: true,
+		}, body(2)))
+		lexer.Add([]byte(`[a-z]+`), func(s *Scanner, m *machines.Match) (interface{}, error) {
+			return s.Token(3, string(m.Bytes), m), nil
+		})
+		lexer.Add([]byte(`( |\n)+`), func(*Scanner, *machines.Match) (interface{}, error) {
+			return nil, nil
+		})
+		return lexer
+	}
+	text := []byte(strings.Join([]string{
+		`a [==[ x ]] ]=] ]==] r##"y "# z"## <<EOF d`,
+		`  one`,
+		` EOF`,
+		`EOF`,
+		`b <<~END`,
+		`    two`,
+		``,
+		`      three`,
+		`  END`,
+		`c <<X <<~Y e`,
+		`x`,
+		`X`,
+		` y`,
+		` Y`,
+		`f`,
+	}, "\n"))
+	expected := []struct {
+		tok   *Token
+		value interface{}
+	}{
+		{&Token{Type: 3, Lexeme: []byte("a"), TC: 0, StartLine: 1, StartColumn: 1, EndLine: 1, EndColumn: 1}, "a"},
+		{&Token{Type: 0, Lexeme: []byte("[==[ x ]] ]=] ]==]"), TC: 2, StartLine: 1, StartColumn: 3, EndLine: 1, EndColumn: 20}, [2]string{" x ]] ]=] ", "6 (1, 7)-(1, 16)"}},
+		{&Token{Type: 1, Lexeme: []byte(`r##"y "# z"##`), TC: 21, StartLine: 1, StartColumn: 22, EndLine: 1, EndColumn: 34}, [2]string{`y "# z`, "25 (1, 26)-(1, 31)"}},
+		{&Token{Type: 2, Lexeme: []byte("<<EOF"), TC: 35, StartLine: 1, StartColumn: 36, EndLine: 1, EndColumn: 40}, [2]string{"  one\n EOF\n", "43 (2, 1)-(4, 0)"}},
+		{&Token{Type: 3, Lexeme: []byte("d"), TC: 41, StartLine: 1, StartColumn: 42, EndLine: 1, EndColumn: 42}, "d"},
+		{&Token{Type: 3, Lexeme: []byte("b"), TC: 58, StartLine: 5, StartColumn: 1, EndLine: 5, EndColumn: 1}, "b"},
+		{&Token{Type: 2, Lexeme: []byte("<<~END"), TC: 60, StartLine: 5, StartColumn: 3, EndLine: 5, EndColumn: 8}, [2]string{"two\n\n  three\n", "67 (6, 1)-(9, 0)"}},
+		{&Token{Type: 3, Lexeme: []byte("c"), TC: 94, StartLine: 10, StartColumn: 1, EndLine: 10, EndColumn: 1}, "c"},
+		{&Token{Type: 2, Lexeme: []byte("<<X"), TC: 96, StartLine: 10, StartColumn: 3, EndLine: 10, EndColumn: 5}, [2]string{"x\n", "107 (11, 1)-(12, 0)"}},
+		{&Token{Type: 2, Lexeme: []byte("<<~Y"), TC: 100, StartLine: 10, StartColumn: 7, EndLine: 10, EndColumn: 10}, [2]string{"y\n", "111 (13, 1)-(14, 0)"}},
+		{&Token{Type: 3, Lexeme: []byte("e"), TC: 105, StartLine: 10, StartColumn: 12, EndLine: 10, EndColumn: 12}, "e"},
+		{&Token{Type: 3, Lexeme: []byte("f"), TC: 117, StartLine: 15, StartColumn: 1, EndLine: 15, EndColumn: 1}, "f"},
+	}
+	runTest := func(lexer *Lexer) {
+		scanner, err := lexer.Scanner(text)
+		t.AssertNil(err)
+		i := 0
+		for tok, err, eos := scanner.Next(); !eos; tok, err, eos = scanner.Next() {
+			t.AssertNil(err)
+			t.Assert(i < len(expected), "unexpected token %v", tok)
+			tk := tok.(*Token)
+			t.Assert(tk.Equals(expected[i].tok), "expected %v got %v", expected[i].tok, tk)
+			t.Assert(tk.Value == expected[i].value, "expected %q got %q", expected[i].value, tk.Value)
+			i++
+		}
+		t.Assert(i == len(expected), "expected %d tokens got %d", len(expected), i)
+
+		// an empty body is at the start of the terminator
+		for text, at := range map[string]string{"<<EOF\nEOF": "6 (2, 1)-(2, 1)", "[[]]": "2 (1, 3)-(1, 3)"} {
+			scanner, err := lexer.Scanner([]byte(text))
+			t.AssertNil(err)
+			tok, err, _ := scanner.Next()
+			t.AssertNil(err)
+			value := tok.(*Token).Value.([2]string)
+			t.Assert(value == [2]string{"", at}, "%q: expected an empty body at %v got %q", text, at, value)
+		}
+
+		for _, text := range []string{"[=[ ]] ]==]", "<<EOF\n EOF", "<<EOF"} {
+			scanner, err := lexer.Scanner([]byte(text))
+			t.AssertNil(err)
+			_, err, _ = scanner.Next()
+			_, is := err.(*UnterminatedError)
+			t.Assert(is, "%q: expected an UnterminatedError got %v", text, err)
+		}
+	}
+	{
+		lexer := newLexer()
+		t.AssertNil(lexer.CompileNFA())
+		runTest(lexer)
+	}
+	{
+		lexer := newLexer()
+		t.AssertNil(lexer.CompileDFA())
+		runTest(lexer)
+	}
+}
+
+// TestHeredocLinesEdits checks the deferred bodies of heredocs are handled
+// by TokenStream.Edit and ScanParallel as by a single scanner.
+func TestHeredocLinesEdits(x *testing.T) {
+	t := (*test.T)(x)
+	newLexer := func() *Lexer {
+		lexer := NewLexer()
+		lexer.Add([]byte(`<<[AB]`), Heredoc(HeredocConfig{
+			Terminator: func(open []byte) []byte {
+				return open[2:]
+			},
+			Lines: true,
+		}, func(s *Scanner, m *machines.Match, body []byte, bodyMatch *machines.Match) (interface{}, error) {
+			return s.Token(0, string(body), m), nil
+		}))
+		lexer.Add([]byte(`[a-z]+`), func(s *Scanner, m *machines.Match) (interface{}, error) {
+			return s.Token(1, string(m.Bytes), m), nil
+		})
+		lexer.Add([]byte(`( |\n)+`), func(*Scanner, *machines.Match) (interface{}, error) {
+			return nil, nil
+		})
+		return lexer
+	}
+	expectTokens := func(text []byte, toks []interface{}, err error, expected []interface{}, expectedErr error) {
+		t.Assert((err == nil) == (expectedErr == nil), "%q: expected error %v got %v", text, expectedErr, err)
+		if err != nil {
+			t.Assert(err.Error() == expectedErr.Error(), "%q: expected error %v got %v", text, expectedErr, err)
+		}
+		t.Assert(len(toks) == len(expected), "expected %d tokens got %d for %q", len(expected), len(toks), text)
+		for i := range toks {
+			tok, exp := toks[i].(*Token), expected[i].(*Token)
+			t.Assert(tok.Equals(exp) && tok.Value == exp.Value, "%q: expected %v got %v", text, exp, tok)
+		}
+	}
+	pieces := []string{"<<A", "<<B", " ", "\n", "x", "A", "\nA\n", "\nB\n"}
+	r := rand.New(rand.NewSource(11))
+	randText := func(n int) []byte {
+		var buf bytes.Buffer
+		for i := 0; i < n; i++ {
+			buf.WriteString(pieces[r.Intn(len(pieces))])
+		}
+		return buf.Bytes()
+	}
+	runTest := func(lexer *Lexer) {
+		for trial := 0; trial < 100; trial++ {
+			ts, err := lexer.TokenStream(randText(r.Intn(60)))
+			t.AssertNil(err)
+			for edit := 0; edit < 10; edit++ {
+				start := r.Intn(len(ts.Text) + 1)
+				end := start + r.Intn(len(ts.Text)-start+1)/4
+				_, err := ts.Edit(start, end, randText(r.Intn(3)))
+				t.AssertNil(err)
+				expected, err := lexer.TokenStream(ts.Text)
+				t.AssertNil(err)
+				expectTokens(ts.Text, ts.Tokens, ts.Err, expected.Tokens, expected.Err)
+
+				var boundaries []int
+				for b := r.Intn(7) + 1; b < len(ts.Text); b += r.Intn(13) + 1 {
+					boundaries = append(boundaries, b)
+				}
+				toks, err := lexer.ScanParallel(ts.Text, boundaries, 2)
+				expectTokens(ts.Text, toks, err, expected.Tokens, expected.Err)
+				toks, err = lexer.ScanParallel(ts.Text, nil, 3)
+				expectTokens(ts.Text, toks, err, expected.Tokens, expected.Err)
+			}
+		}
+	}
+	{
+		lexer := newLexer()
+		t.AssertNil(lexer.CompileNFA())
+		runTest(lexer)
+	}
+	{
+		lexer := newLexer()
+		t.AssertNil(lexer.CompileDFA())
+		runTest(lexer)
+	}
+}
@@ -0,0 +1,189 @@
+// Package highlight renders text highlighted by the tokens of a lexmachine
+// Lexer. It is useful for eyeballing how a lexer splits a file.
+//
+//     styles := highlight.Styles{
+//         tokenIds["ID"]:        "34",   // blue
+//         tokenIds["STRING"]:    "1;32", // bold green
+//         highlight.Unmatched:   "41",   // red background
+//     }
+//     err := highlight.Highlight(os.Stdout, lexer, styles, text, highlight.ANSI)
+//
+// Every byte of the text is written exactly once: the text of tokens with a
+// style is wrapped in the style, the text skipped by the lexer (for instance
+// whitespace) and the text of tokens without a style is written unchanged,
+// and text the lexer could not match is written with the Unmatched style
+// (scanning resumes after it).
+package highlight
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/timtadh/lexmachine"
+	"github.com/timtadh/lexmachine/machines"
+)
+
+// Unmatched is the key in Styles of the style for text the lexer could not
+// match.
+const Unmatched = -1
+
+// Styles maps token types (lexmachine.Token.Type) to styles. For the ANSI
+// format a style is the parameters of an SGR escape sequence (such as "1;31"
+// for bold red, see ParseANSIStyle). For the HTML format it is a CSS class.
+type Styles map[int]string
+
+// Format selects how the highlighted text is rendered.
+type Format int
+
+const (
+	// ANSI renders the text with ANSI terminal escape sequences.
+	ANSI Format = iota
+	// HTML renders the text as HTML with the styled parts wrapped in
+	// <span class="style"> elements. The caller should wrap the output in a
+	// <pre> element.
+	HTML
+)
+
+// Highlight lexes text with lexer and writes the text to w highlighted with
+// styles in the given format. The lexer's Actions must return
+// *lexmachine.Token values (or nil for skipped text).
+func Highlight(w io.Writer, lexer *lexmachine.Lexer, styles Styles, text []byte, format Format) error {
+	scanner, err := lexer.Scanner(text)
+	if err != nil {
+		return err
+	}
+	r := &renderer{w: w, styles: styles, format: format, text: scanner.Text}
+	for tok, err, eos := scanner.Next(); !eos; tok, err, eos = scanner.Next() {
+		if ui, is := err.(*machines.UnconsumedInput); is {
+			r.write(ui.StartTC, ui.FailTC, Unmatched)
+			scanner.TC = ui.FailTC
+			if ui.FailTC <= ui.StartTC {
+				scanner.TC = ui.StartTC + 1
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+		t, is := tok.(*lexmachine.Token)
+		if !is {
+			return fmt.Errorf("expected a *lexmachine.Token got %T", tok)
+		}
+		r.write(t.TC, t.TC+len(t.Lexeme), t.Type)
+	}
+	r.write(len(r.text), len(r.text), Unmatched)
+	return r.err
+}
+
+// renderer writes the text in order. Text between the written regions is
+// written without a style.
+type renderer struct {
+	w      io.Writer
+	styles Styles
+	format Format
+	text   []byte
+	tc     int // the text has been written up to here
+	err    error
+}
+
+// write the text from start to end in the style of typ.
+func (r *renderer) write(start, end, typ int) {
+	if end > len(r.text) {
+		end = len(r.text)
+	}
+	if start < r.tc {
+		start = r.tc
+	}
+	r.plain(r.text[r.tc:start])
+	if start >= end {
+		return
+	}
+	style, has := r.styles[typ]
+	if !has || style == "" {
+		r.plain(r.text[start:end])
+	} else if r.format == HTML {
+		r.print(`<span class="`, html.EscapeString(style), `">`, html.EscapeString(string(r.text[start:end])), `</span>`)
+	} else {
+		r.print("\x1b[", style, "m", string(r.text[start:end]), "\x1b[0m")
+	}
+	r.tc = end
+}
+
+// plain writes text without a style.
+func (r *renderer) plain(text []byte) {
+	if len(text) == 0 {
+		return
+	}
+	if r.format == HTML {
+		r.print(html.EscapeString(string(text)))
+	} else {
+		r.print(string(text))
+	}
+	r.tc += len(text)
+}
+
+func (r *renderer) print(parts ...string) {
+	for _, part := range parts {
+		if r.err != nil {
+			return
+		}
+		_, r.err = io.WriteString(r.w, part)
+	}
+}
+
+// ansiNames maps the names accepted by ParseANSIStyle to SGR parameters.
+var ansiNames = map[string]string{
+	"bold":       "1",
+	"faint":      "2",
+	"italic":     "3",
+	"underline":  "4",
+	"reverse":    "7",
+	"black":      "30",
+	"red":        "31",
+	"green":      "32",
+	"yellow":     "33",
+	"blue":       "34",
+	"magenta":    "35",
+	"cyan":       "36",
+	"white":      "37",
+	"on-black":   "40",
+	"on-red":     "41",
+	"on-green":   "42",
+	"on-yellow":  "43",
+	"on-blue":    "44",
+	"on-magenta": "45",
+	"on-cyan":    "46",
+	"on-white":   "47",
+}
+
+// ParseANSIStyle converts a human readable style such as "bold+red" or
+// "underline+on-blue" into SGR parameters ("1;31" and "4;44"). The parts may
+// be names (bold, faint, italic, underline, reverse, the colors black, red,
+// green, yellow, blue, magenta, cyan and white, and the background colors
+// on-black through on-white) or SGR parameters.
+func ParseANSIStyle(style string) (string, error) {
+	parts := strings.Split(style, "+")
+	codes := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if code, has := ansiNames[part]; has {
+			codes = append(codes, code)
+		} else if isSGR(part) {
+			codes = append(codes, part)
+		} else {
+			return "", fmt.Errorf("unknown ANSI style %q", part)
+		}
+	}
+	return strings.Join(codes, ";"), nil
+}
+
+// isSGR checks if s is a list of SGR parameters such as "38;5;196".
+func isSGR(s string) bool {
+	for _, param := range strings.Split(s, ";") {
+		if _, err := strconv.ParseUint(param, 10, 8); err != nil {
+			return false
+		}
+	}
+	return true
+}
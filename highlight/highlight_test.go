@@ -0,0 +1,54 @@
+package highlight
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/timtadh/data-structures/test"
+	"github.com/timtadh/lexmachine"
+	"github.com/timtadh/lexmachine/machines"
+)
+
+func newLexer() *lexmachine.Lexer {
+	token := func(typ int) lexmachine.Action {
+		return func(s *lexmachine.Scanner, m *machines.Match) (interface{}, error) {
+			return s.Token(typ, string(m.Bytes), m), nil
+		}
+	}
+	lexer := lexmachine.NewLexer()
+	lexer.Add([]byte(`[a-z]+`), token(0))
+	lexer.Add([]byte(`[0-9]+`), token(1))
+	lexer.Add([]byte(`<|>`), token(2))
+	lexer.Add([]byte(`( |\n)+`), func(*lexmachine.Scanner, *machines.Match) (interface{}, error) {
+		return nil, nil
+	})
+	return lexer
+}
+
+func TestHighlight(x *testing.T) {
+	t := (*test.T)(x)
+	text := []byte("ab 12 $$ < cd\n")
+	styles := Styles{0: "34", 2: "1;31", Unmatched: "41"}
+	var ansi bytes.Buffer
+	t.AssertNil(Highlight(&ansi, newLexer(), styles, text, ANSI))
+	expected := "\x1b[34mab\x1b[0m 12 \x1b[41m$\x1b[0m\x1b[41m$\x1b[0m \x1b[1;31m<\x1b[0m \x1b[34mcd\x1b[0m\n"
+	t.Assert(ansi.String() == expected, "expected %q got %q", expected, ansi.String())
+
+	styles = Styles{0: "id", 2: "op", Unmatched: "error"}
+	var html bytes.Buffer
+	t.AssertNil(Highlight(&html, newLexer(), styles, text, HTML))
+	expected = `<span class="id">ab</span> 12 <span class="error">$</span><span class="error">$</span> <span class="op">&lt;</span> <span class="id">cd</span>` + "\n"
+	t.Assert(html.String() == expected, "expected %q got %q", expected, html.String())
+}
+
+func TestParseANSIStyle(x *testing.T) {
+	t := (*test.T)(x)
+	style, err := ParseANSIStyle("bold+red")
+	t.AssertNil(err)
+	t.Assert(style == "1;31", "got %q", style)
+	style, err = ParseANSIStyle("38;5;196+on-blue")
+	t.AssertNil(err)
+	t.Assert(style == "38;5;196;44", "got %q", style)
+	_, err = ParseANSIStyle("bold+wat")
+	t.Assert(err != nil, "expected an error")
+}
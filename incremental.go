@@ -0,0 +1,180 @@
+package lexmachine
+
+import (
+	"fmt"
+	"sort"
+)
+
+// A TokenStream holds the tokens of a text and updates them as the text is
+// edited. Rather than re-lexing the whole text after an edit it re-lexes from
+// the last token whose scan examined the edited bytes until the scan is back
+// at the start of a token of the old stream at the same column. The tokens
+// from there on are reused. This makes it suitable for editors and
+// language servers which re-lex a document on every keystroke.
+//
+// Actions must not depend on state carried from one token to the next (other
+// than Scanner.TC) as the text is not re-lexed from the beginning.
+type TokenStream struct {
+	Text    []byte        // the current text (do not modify it)
+	Tokens  []interface{} // the tokens of the text (the non-nil values returned by the Actions)
+	Err     error         // the error which stopped the scan (nil if the end of the text was reached)
+	scanner *Scanner      // reset to lex each new text (so a FileSet holds one file for the stream)
+	calls   []call        // calls[i] produced Tokens[i]. The last call found Err or the end of the text.
+}
+
+// A Change describes how an Edit changed a TokenStream: the old tokens
+// Tokens[Start:End] were replaced by the new Tokens. The tokens after the
+// change were moved by TCDelta bytes and LineDelta lines. The TokenStream
+// updates the positions of the *Token values it reuses. Other token types
+// must be updated by the caller.
+type Change struct {
+	Start, End int
+	Tokens     []interface{}
+	TCDelta    int
+	LineDelta  int
+}
+
+// TokenStream lexes text and returns a TokenStream which can be edited. See
+// CompiledLexer.TokenStream.
+func (l *Lexer) TokenStream(text []byte, options ...ScannerOption) (*TokenStream, error) {
+	c, err := l.Compiled()
+	if err != nil {
+		return nil, err
+	}
+	return c.TokenStream(text, options...)
+}
+
+// TokenStream lexes (a copy of) text with the given scanner options and
+// returns a TokenStream which can be updated with Edit. An error which stops
+// the scan is recorded in TokenStream.Err. A text longer than the MaxBytes
+// limit is rejected (with a *LimitError) before it is copied.
+func (c *CompiledLexer) TokenStream(text []byte, options ...ScannerOption) (*TokenStream, error) {
+	s, err := c.scanner(text, false, options)
+	if err != nil {
+		return nil, err
+	}
+	ts := &TokenStream{
+		Text:    append([]byte(nil), text...),
+		scanner: s,
+	}
+	s.record = true
+	s.Reset(ts.Text)
+	ts.Tokens, ts.calls, ts.Err, _ = ts.lex(ts.scanner, 0, 0, 0)
+	return ts, nil
+}
+
+// Edit replaces the bytes Text[start:end] with text and re-lexes the part of
+// the stream affected by the edit. The new text is always a new slice so the
+// Lexemes of the old tokens stay valid.
+func (ts *TokenStream) Edit(start, end int, text []byte) (*Change, error) {
+	if start < 0 || end < start || end > len(ts.Text) {
+		return nil, fmt.Errorf("edit [%d, %d) is out of range [0, %d]", start, end, len(ts.Text))
+	}
+	newText := make([]byte, 0, len(ts.Text)-(end-start)+len(text))
+	newText = append(newText, ts.Text[:start]...)
+	newText = append(newText, text...)
+	newText = append(newText, ts.Text[end:]...)
+	delta := len(text) - (end - start)
+
+	// the first call which examined the edited bytes (or the end of the text)
+	first := 0
+	for first < len(ts.calls)-1 && ts.calls[first].lookahead <= start {
+		first++
+	}
+	// the scan restarts without deferred heredoc bodies
+	for first > 0 && ts.calls[first].deferred {
+		first--
+	}
+
+	s := ts.scanner
+	s.Reset(newText)
+	tokens, calls, err, synced := ts.lex(s, ts.calls[first].tc, end+delta, delta)
+	change := &Change{
+		Start:   first,
+		End:     len(ts.Tokens),
+		Tokens:  tokens,
+		TCDelta: delta,
+	}
+	if synced >= 0 {
+		// reuse the old tokens after the old call synced
+		old := ts.calls[synced]
+		now := calls[len(calls)-1]
+		change.End = synced + 1
+		change.LineDelta = now.line - old.line
+		for _, c := range ts.calls[synced+1:] {
+			c.tc += delta
+			c.lookahead += delta
+			c.line += change.LineDelta
+			calls = append(calls, c)
+		}
+		for _, tok := range ts.Tokens[synced+1:] {
+			if t, is := tok.(*Token); is {
+				t.TC += delta
+				t.StartLine += change.LineDelta
+				t.EndLine += change.LineDelta
+				t.Pos = s.pos(t.TC)
+			}
+			tokens = append(tokens, tok)
+		}
+		if ts.Err != nil {
+			// recreate the error so its position is correct for the new text
+			// (from the last call which started without deferred heredoc
+			// bodies)
+			k := len(calls) - 1
+			for k > 0 && calls[k].deferred {
+				k--
+			}
+			s.TC = calls[k].tc
+			s.deferred = nil
+			for ; k < len(calls); k++ {
+				_, err, _ = s.Next()
+			}
+		}
+	}
+	ts.Text = newText
+	ts.Tokens = append(ts.Tokens[:first:first], tokens...)
+	ts.calls = append(ts.calls[:first:first], calls...)
+	ts.Err = err
+	return change, nil
+}
+
+// lex the text from tc with the scanner s until an error or the end of the
+// text. If a call starts at or after the text counter sync and is at the
+// position of an old call shifted by delta the scan stops and the index of
+// the old call is returned as synced (otherwise synced is -1). The calls
+// returned then end with the call which synced.
+func (ts *TokenStream) lex(s *Scanner, tc, sync, delta int) (tokens []interface{}, calls []call, err error, synced int) {
+	s.TC = tc
+	for {
+		tok, err, eos := s.Next()
+		c := s.call
+		if s.TC >= len(s.Text) {
+			// the action moved the scanner to the end of the text
+			c.lookahead = len(s.Text) + 1
+		} else if s.TC > c.lookahead {
+			// the action moved the scanner past what the engine examined
+			c.lookahead = s.TC
+		}
+		calls = append(calls, c)
+		if err != nil || eos {
+			return tokens, calls, err, -1
+		}
+		tokens = append(tokens, tok)
+		if c.tc >= sync && ts.calls != nil && !c.deferred {
+			// the calls must both start without deferred heredoc bodies
+			if i, found := ts.findCall(c.tc - delta); found && i < len(ts.calls)-1 {
+				if ts.calls[i].column == c.column && !ts.calls[i].deferred {
+					return tokens, calls, nil, i
+				}
+			}
+		}
+	}
+}
+
+// findCall finds the old call which started at tc.
+func (ts *TokenStream) findCall(tc int) (int, bool) {
+	i := sort.Search(len(ts.calls), func(i int) bool {
+		return ts.calls[i].tc >= tc
+	})
+	return i, i < len(ts.calls) && ts.calls[i].tc == tc
+}
@@ -0,0 +1,115 @@
+package lexmachine
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/timtadh/data-structures/test"
+	"github.com/timtadh/lexmachine/machines"
+)
+
+func TestTokenStream(x *testing.T) {
+	t := (*test.T)(x)
+	newLexer := func() *Lexer {
+		token := func(typ int) Action {
+			return func(s *Scanner, m *machines.Match) (interface{}, error) {
+				return s.Token(typ, string(m.Bytes), m), nil
+			}
+		}
+		lexer := NewLexer()
+		lexer.Add([]byte(`[a-z]+`), token(0))
+		lexer.Add([]byte(`x+y|x`), token(1)) // needs lookahead past the end of its match
+		lexer.Add([]byte(`"[^"]*"`), token(2))
+		lexer.Add([]byte(`/\*([^*]|\*+[^*/])*\*+/`), token(3))
+		lexer.Add([]byte(`( |\t|\r|\n)+`), func(*Scanner, *machines.Match) (interface{}, error) {
+			return nil, nil
+		})
+		return lexer
+	}
+	expectStream := func(lexer *Lexer, ts *TokenStream, options []ScannerOption) {
+		expected, err := lexer.TokenStream(ts.Text, options...)
+		t.AssertNil(err)
+		t.Assert((ts.Err == nil) == (expected.Err == nil), "expected error %v got %v", expected.Err, ts.Err)
+		if ts.Err != nil {
+			t.Assert(ts.Err.Error() == expected.Err.Error(), "expected error %v got %v", expected.Err, ts.Err)
+		}
+		t.Assert(len(ts.Tokens) == len(expected.Tokens), "expected %d tokens got %d for %q", len(expected.Tokens), len(ts.Tokens), ts.Text)
+		for i := range ts.Tokens {
+			t.Assert(ts.Tokens[i].(*Token).Equals(expected.Tokens[i].(*Token)), "%q: expected %v got %v", ts.Text, expected.Tokens[i], ts.Tokens[i])
+		}
+	}
+	pieces := []string{"abc", "x", "xxy", " ", "\t", "\n", "\r\n", "\"", "/*", "*/", "*", "$"}
+	r := rand.New(rand.NewSource(3))
+	randText := func(n int) []byte {
+		var buf bytes.Buffer
+		for i := 0; i < n; i++ {
+			buf.WriteString(pieces[r.Intn(len(pieces))])
+		}
+		return buf.Bytes()
+	}
+	runTest := func(lexer *Lexer, options []ScannerOption) {
+		for trial := 0; trial < 50; trial++ {
+			ts, err := lexer.TokenStream(randText(r.Intn(100)), options...)
+			t.AssertNil(err)
+			for edit := 0; edit < 20; edit++ {
+				start := r.Intn(len(ts.Text) + 1)
+				end := start + r.Intn(len(ts.Text)-start+1)/4
+				old := append([]interface{}(nil), ts.Tokens...)
+				change, err := ts.Edit(start, end, randText(r.Intn(3)))
+				t.AssertNil(err)
+				t.Assert(change.Start <= change.End && change.End <= len(old), "bad change %v", change)
+				t.Assert(len(ts.Tokens) == len(old)-(change.End-change.Start)+len(change.Tokens), "bad change %v", change)
+				expectStream(lexer, ts, options)
+			}
+		}
+	}
+	options := []ScannerOption{WithTabWidth(4), WithNewlines(machines.CRLF)}
+	{
+		lexer := newLexer()
+		t.AssertNil(lexer.CompileNFA())
+		runTest(lexer, nil)
+		runTest(lexer, options)
+	}
+	{
+		lexer := newLexer()
+		t.AssertNil(lexer.CompileDFA())
+		runTest(lexer, nil)
+		runTest(lexer, options)
+	}
+}
+
+func TestTokenStreamEditIsLocal(x *testing.T) {
+	t := (*test.T)(x)
+	lexer := NewLexer()
+	lexer.Add([]byte(`[a-z]+`), func(s *Scanner, m *machines.Match) (interface{}, error) {
+		return s.Token(0, string(m.Bytes), m), nil
+	})
+	lexer.Add([]byte(`( |\n)+`), func(*Scanner, *machines.Match) (interface{}, error) {
+		return nil, nil
+	})
+	var text bytes.Buffer
+	for i := 0; i < 1000; i++ {
+		text.WriteString("foo bar baz\n")
+	}
+	ts, err := lexer.TokenStream(text.Bytes())
+	t.AssertNil(err)
+	t.Assert(len(ts.Tokens) == 3000, "expected 3000 tokens got %d", len(ts.Tokens))
+
+	// insert a new line in the middle of the text
+	change, err := ts.Edit(6000, 6000, []byte("wat\n"))
+	t.AssertNil(err)
+	t.Assert(change.Start == 1500 && change.End == 1502, "unexpected change %v", change)
+	t.Assert(len(change.Tokens) == 3, "unexpected change %v", change)
+	t.Assert(change.TCDelta == 4 && change.LineDelta == 1, "unexpected change %v", change)
+	last := ts.Tokens[len(ts.Tokens)-1].(*Token)
+	t.Assert(last.TC == 12000 && last.StartLine == 1001 && last.StartColumn == 9, "unexpected last token %v", last)
+
+	// join two words on the first line (the columns of the rest of the line
+	// change so it is re-lexed up to the next line)
+	change, err = ts.Edit(3, 4, nil)
+	t.AssertNil(err)
+	t.Assert(change.Start == 0 && change.End == 4, "unexpected change %v", change)
+	t.Assert(len(change.Tokens) == 3, "unexpected change %v", change)
+	t.Assert(ts.Tokens[0].(*Token).Value == "foobar", "unexpected token %v", ts.Tokens[0])
+}
@@ -2,6 +2,7 @@ package inst
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -90,3 +91,58 @@ func (is Slice) Serialize() (s string) {
 	}
 	return strings.Join(lines, "\n")
 }
+
+// Dotty translates the program into Graphviz source code suitable for
+// visualization with the `dot` command. Each instruction is a node. CHAR
+// instructions have an edge labeled with their byte range to the next
+// instruction. SPLIT and JMP instructions have dashed (empty) edges to their
+// targets. The first target of a SPLIT (which has priority) is labeled 1 and
+// the second 2.
+func (is Slice) Dotty() string {
+	return is.DottyLabeled(nil)
+}
+
+// DottyLabeled is Dotty with the MATCH instructions labeled by
+// labels[match-id] (for instance the pattern or the name of the token). The
+// match-id of a MATCH instruction is the number of MATCH instructions before
+// it in the program.
+func (is Slice) DottyLabeled(labels []string) string {
+	quote := func(s string) string {
+		q := strconv.Quote(s)
+		return q[1 : len(q)-1]
+	}
+	char := func(c uint32) string {
+		return quote(string([]byte{byte(c)}))
+	}
+	lines := make([]string, 0, 2*len(is))
+	lines = append(lines, "digraph NFA {")
+	lines = append(lines, "rankdir=LR")
+	lines = append(lines, "node [shape=circle]")
+	lines = append(lines, `start [shape="none", label=""]`)
+	lines = append(lines, "start -> 0 [label=start]")
+	matchID := 0
+	for pc, inst := range is {
+		switch inst.Op {
+		case CHAR:
+			label := char(inst.X)
+			if inst.X != inst.Y {
+				label += "-" + char(inst.Y)
+			}
+			lines = append(lines, fmt.Sprintf(`%d -> %d [label="%s"]`, pc, pc+1, label))
+		case SPLIT:
+			lines = append(lines, fmt.Sprintf(`%d -> %d [style=dashed, label="1"]`, pc, inst.X))
+			lines = append(lines, fmt.Sprintf(`%d -> %d [style=dashed, label="2"]`, pc, inst.Y))
+		case JMP:
+			lines = append(lines, fmt.Sprintf(`%d -> %d [style=dashed]`, pc, inst.X))
+		case MATCH:
+			label := fmt.Sprintf("matches %d", matchID)
+			if matchID < len(labels) {
+				label = quote(labels[matchID])
+			}
+			lines = append(lines, fmt.Sprintf(`%d [style=bold, peripheries=2, xlabel="%s"]`, pc, label))
+			matchID++
+		}
+	}
+	lines = append(lines, "}")
+	return strings.Join(lines, "\n")
+}
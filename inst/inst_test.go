@@ -1,6 +1,9 @@
 package inst
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestPrint(t *testing.T) {
 	i := New(CHAR, uint32('a'), 0)
@@ -18,3 +21,24 @@ func TestPrint(t *testing.T) {
 	s[3] = l
 	t.Log(s)
 }
+
+func TestDotty(t *testing.T) {
+	s := Slice{
+		New(SPLIT, 1, 3),
+		New(CHAR, uint32('a'), uint32('z')),
+		New(JMP, 0, 0),
+		New(MATCH, 0, 0),
+	}
+	dot := s.DottyLabeled([]string{"ID"})
+	for _, line := range []string{
+		`0 -> 1 [style=dashed, label="1"]`,
+		`0 -> 3 [style=dashed, label="2"]`,
+		`1 -> 2 [label="a-z"]`,
+		`2 -> 0 [style=dashed]`,
+		`3 [style=bold, peripheries=2, xlabel="ID"]`,
+	} {
+		if !strings.Contains(dot, line) {
+			t.Errorf("expected %q in\n%v", line, dot)
+		}
+	}
+}
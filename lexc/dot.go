@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+)
+
+import (
+	"github.com/timtadh/getopt"
+)
+
+import (
+	"github.com/timtadh/lexmachine/dfa"
+	"github.com/timtadh/lexmachine/frontend"
+	"github.com/timtadh/lexmachine/inst"
+)
+
+var dotUsage = "lexc dot [--nfa|--dfa|--min] [options]"
+var dotMessage = `
+lexc dot prints the automaton the patterns compile to as Graphviz source.
+View it with: lexc dot -p <pattern> | dot -Tsvg > lexer.svg
+
+Options
+    -h, --help                          print this message
+    --nfa                               print the NFA program
+    --dfa                               print the DFA before minimization
+    --min                               print the minimized DFA (the default,
+                                        this is the DFA the lexer runs)
+` + lexerMessage + `
+    The accepting states are labeled with the name of their token (or the
+    pattern if the token is not named).
+`
+
+func dotCmd(args []string) {
+	short := "h" + lexerShort
+	long := append([]string{
+		"help",
+		"dfa",
+		"min",
+	}, lexerLong...)
+
+	_, optargs, err := getopt.GetOpt(args, short, long)
+	if err != nil {
+		log.Print(err)
+		subUsage(dotUsage, dotMessage, 1)
+	}
+
+	spec := new(lexerSpec)
+	machine := "min"
+	for _, oa := range optargs {
+		switch oa.Opt() {
+		case "-h", "--help":
+			subUsage(dotUsage, dotMessage, 0)
+		case "--nfa":
+			machine = "nfa"
+		case "--dfa":
+			machine = "dfa"
+		case "--min":
+			machine = "min"
+		default:
+			if _, err := spec.option(oa.Opt(), oa.Arg()); err != nil {
+				log.Print(err)
+				subUsage(dotUsage, dotMessage, 1)
+			}
+		}
+	}
+
+	lexer, err := spec.uncompiled()
+	if err != nil {
+		log.Print(err)
+		subUsage(dotUsage, dotMessage, 1)
+	}
+	ast, err := lexer.AST()
+	if err != nil {
+		log.Print(err)
+		subUsage(dotUsage, dotMessage, 1)
+	}
+	labels := spec.labels()
+
+	switch machine {
+	case "nfa":
+		var program inst.Slice
+		if frontend.HasSetOps(ast) {
+			// as in the lexer the NFA for set operators is the program
+			// translated from the DFA
+			dfa, err := dfa.Generate(ast)
+			if err != nil {
+				log.Fatal(err)
+			}
+			program = dfa.Program()
+		} else if program, err = frontend.Generate(ast); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(program.DottyLabeled(labels))
+	case "dfa":
+		dfa, err := dfa.GenerateUnminimized(ast)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(dfa.DottyLabeled(labels))
+	case "min":
+		dfa, err := dfa.Generate(ast)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(dfa.DottyLabeled(labels))
+	}
+}
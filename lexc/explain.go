@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+import (
+	"github.com/timtadh/getopt"
+)
+
+import (
+	"github.com/timtadh/lexmachine"
+	"github.com/timtadh/lexmachine/machines"
+)
+
+var explainUsage = "lexc explain [options] [<file>]"
+var explainMessage = `
+lexc explain lexes a file (or stdin) and explains how each token was matched:
+the states the engine walked through, every pattern which matched a prefix
+of the text at the start of the token and why the winning pattern won
+(longest match, priority or shortest match).
+
+Options
+    -h, --help                          print this message
+    -e, --text=<text>                   explain the text instead of a file
+    --no-path                           do not print the engine's path
+` + lexerMessage + `
+    The states in the path are DFA states (see lexc dot --min) or with --nfa
+    the number of NFA threads still running.
+`
+
+func explainCmd(args []string) {
+	short := "he:" + lexerShort
+	long := append([]string{
+		"help",
+		"text=",
+		"no-path",
+	}, lexerLong...)
+
+	leftovers, optargs, err := getopt.GetOpt(args, short, long)
+	if err != nil {
+		log.Print(err)
+		subUsage(explainUsage, explainMessage, 1)
+	}
+
+	spec := new(lexerSpec)
+	var text []byte
+	showPath := true
+	for _, oa := range optargs {
+		if isLexerOpt, err := spec.option(oa.Opt(), oa.Arg()); err != nil {
+			log.Print(err)
+			subUsage(explainUsage, explainMessage, 1)
+		} else if isLexerOpt {
+			continue
+		}
+		switch oa.Opt() {
+		case "-h", "--help":
+			subUsage(explainUsage, explainMessage, 0)
+		case "-e", "--text":
+			text = []byte(oa.Arg())
+		case "--no-path":
+			showPath = false
+		}
+	}
+
+	lexer, err := spec.lexer()
+	if err != nil {
+		log.Print(err)
+		subUsage(explainUsage, explainMessage, 1)
+	}
+	if text == nil {
+		text, err = readInput(leftovers)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	labels := spec.labels()
+	explain := func(e *lexmachine.Explanation) {
+		fmt.Printf("%q at %d:%d is %s (%v)\n", e.Match.Bytes, e.Match.StartLine, e.Match.StartColumn, labels[e.Pattern], e.Reason)
+		if showPath {
+			fmt.Println("  path:")
+			for _, event := range e.Path {
+				switch event.Kind {
+				case machines.TraceStart:
+					fmt.Printf("    start in state %d\n", event.State)
+				case machines.TraceStep:
+					fmt.Printf("    read %q -> state %d\n", text[event.TC-1], event.State)
+				case machines.TraceAccept:
+					fmt.Printf("    accept %q as %s\n", text[e.Match.TC:event.TC], labels[event.PC])
+				}
+			}
+		}
+		fmt.Println("  candidates:")
+		for _, c := range e.Candidates {
+			fmt.Printf("    %-20s matched %q\n", labels[c.Pattern], text[e.Match.TC:e.Match.TC+c.Length])
+		}
+	}
+	scanner, err := lexer.Scanner(text, lexmachine.WithExplain(explain))
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, err, eos := scanner.Next(); !eos; _, err, eos = scanner.Next() {
+		if err != nil {
+			log.Print(err)
+			os.Exit(1)
+		}
+	}
+}
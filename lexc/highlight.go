@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+import (
+	"github.com/timtadh/getopt"
+)
+
+import (
+	"github.com/timtadh/lexmachine/highlight"
+)
+
+var highlightUsage = "lexc highlight [options] [<file>]"
+var highlightMessage = `
+lexc highlight lexes a file (or stdin) and prints it highlighted by token
+
+Options
+    -h, --help                          print this message
+    --html                              print HTML (default is ANSI colors)
+    --style=<token>=<style>             the style of a token given by name or
+                                        number. use "unmatched" for text the
+                                        lexer could not match.
+` + lexerMessage + `
+Specs
+    <style>
+        for ANSI output: colors and attributes joined by +. eg. bold+red
+        (see ParseANSIStyle in the highlight package). for HTML output: a CSS
+        class. By default each token gets a different color (or the class
+        token-<number>) and unmatched text is shown on a red background (class
+        unmatched).
+`
+
+// ansiPalette gives the tokens without a style a color.
+var ansiPalette = []string{"34", "32", "35", "36", "33", "1;34", "1;32", "1;35", "1;36", "1;33"}
+
+func highlightCmd(args []string) {
+	short := "h" + lexerShort
+	long := append([]string{
+		"help",
+		"html",
+		"style=",
+	}, lexerLong...)
+
+	leftovers, optargs, err := getopt.GetOpt(args, short, long)
+	if err != nil {
+		log.Print(err)
+		subUsage(highlightUsage, highlightMessage, 1)
+	}
+
+	spec := new(lexerSpec)
+	format := highlight.ANSI
+	styleArgs := make([]string, 0, 10)
+	for _, oa := range optargs {
+		if isLexerOpt, err := spec.option(oa.Opt(), oa.Arg()); err != nil {
+			log.Print(err)
+			subUsage(highlightUsage, highlightMessage, 1)
+		} else if isLexerOpt {
+			continue
+		}
+		switch oa.Opt() {
+		case "-h", "--help":
+			subUsage(highlightUsage, highlightMessage, 0)
+		case "--html":
+			format = highlight.HTML
+		case "--style":
+			styleArgs = append(styleArgs, oa.Arg())
+		}
+	}
+
+	lexer, err := spec.lexer()
+	if err != nil {
+		log.Print(err)
+		subUsage(highlightUsage, highlightMessage, 1)
+	}
+
+	styles := make(highlight.Styles)
+	for i, skip := range spec.skip {
+		if skip {
+			continue
+		}
+		if format == highlight.HTML {
+			styles[i] = fmt.Sprintf("token-%d", i)
+		} else {
+			styles[i] = ansiPalette[i%len(ansiPalette)]
+		}
+	}
+	if format == highlight.HTML {
+		styles[highlight.Unmatched] = "unmatched"
+	} else {
+		styles[highlight.Unmatched] = "41"
+	}
+	for _, arg := range styleArgs {
+		i := strings.LastIndex(arg, "=")
+		if i <= 0 {
+			log.Fatalf("expected <token>=<style> got %q", arg)
+		}
+		typ := highlight.Unmatched
+		if arg[:i] != "unmatched" {
+			typ, err = spec.tokenType(arg[:i])
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		style := arg[i+1:]
+		if format == highlight.ANSI {
+			style, err = highlight.ParseANSIStyle(style)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		styles[typ] = style
+	}
+
+	text, err := readInput(leftovers)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if format == highlight.HTML {
+		fmt.Print(`<pre class="lexmachine">`)
+	}
+	err = highlight.Highlight(os.Stdout, lexer, styles, text, format)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if format == highlight.HTML {
+		fmt.Println(`</pre>`)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+import (
+	"github.com/timtadh/data-structures/test"
+)
+
+var testSpec = `# a tiny lexer
+ID      [a-z]+
+NUMBER  [0-9]+
+IF      if
+_       ( |\n)+
+`
+
+// run runs the lexc command with args in dir and returns what it printed.
+func run(t *test.T, dir string, args []string) string {
+	out, err := ioutil.TempFile(dir, "stdout")
+	t.AssertNil(err)
+	defer out.Close()
+	wd, err := os.Getwd()
+	t.AssertNil(err)
+	t.AssertNil(os.Chdir(dir))
+	stdout := os.Stdout
+	os.Stdout = out
+	defer func() {
+		os.Stdout = stdout
+		t.AssertNil(os.Chdir(wd))
+	}()
+	commands[args[0]](args[1:])
+	printed, err := ioutil.ReadFile(out.Name())
+	t.AssertNil(err)
+	return string(printed)
+}
+
+func TestCommands(x *testing.T) {
+	t := (*test.T)(x)
+	dir, err := ioutil.TempDir("", "lexc")
+	t.AssertNil(err)
+	defer os.RemoveAll(dir)
+	t.AssertNil(ioutil.WriteFile(filepath.Join(dir, "spec"), []byte(testSpec), 0644))
+	t.AssertNil(ioutil.WriteFile(filepath.Join(dir, "in"), []byte("x 12\nif"), 0644))
+
+	tests := []struct {
+		args []string
+		// the output is want or, for the automata whose states are not
+		// numbered in a fixed order, has each of the lines in want
+		want      string
+		someLines bool
+	}{
+		{
+			args: []string{"tokenize", "-f", "spec", "in"},
+			want: "FILE  TOKEN   LEXEME  OFFSETS  POSITION\n" +
+				"in    ID      \"x\"     0-1      1:1-1:1\n" +
+				"in    NUMBER  \"12\"    2-4      1:3-1:4\n" +
+				"in    ID      \"if\"    5-7      2:1-2:2\n",
+		},
+		{
+			args: []string{"tokenize", "-o", "json", "-t", "ID=[a-z]+", "-t", "NUMBER=[0-9]+", "-s", "( |\n)+", "in"},
+			want: `{"file":"in","token":"ID","type":0,"lexeme":"x","start":0,"end":1,"start_line":1,"start_column":1,"end_line":1,"end_column":1}` + "\n" +
+				`{"file":"in","token":"NUMBER","type":1,"lexeme":"12","start":2,"end":4,"start_line":1,"start_column":3,"end_line":1,"end_column":4}` + "\n" +
+				`{"file":"in","token":"ID","type":0,"lexeme":"if","start":5,"end":7,"start_line":2,"start_column":1,"end_line":2,"end_column":2}` + "\n",
+		},
+		{
+			args: []string{"tokenize", "-o", "csv", "-f", "spec", "in"},
+			want: "file,token,type,lexeme,start,end,start_line,start_column,end_line,end_column\n" +
+				"in,ID,0,x,0,1,1,1,1,1\n" +
+				"in,NUMBER,1,12,2,4,1,3,1,4\n" +
+				"in,ID,0,if,5,7,2,1,2,2\n",
+		},
+		{
+			args: []string{"highlight", "-f", "spec", "in"},
+			want: "\x1b[34mx\x1b[0m \x1b[32m12\x1b[0m\n\x1b[34mif\x1b[0m",
+		},
+		{
+			args: []string{"highlight", "--html", "--style=NUMBER=num", "-f", "spec", "in"},
+			want: `<pre class="lexmachine"><span class="token-0">x</span> <span class="num">12</span>` + "\n" +
+				`<span class="token-0">if</span></pre>` + "\n",
+		},
+		{
+			args: []string{"explain", "--no-path", "-f", "spec", "-e", "if 1"},
+			want: `"if" at 1:1 is ID (priority)` + "\n" +
+				"  candidates:\n" +
+				`    ID                   matched "if"` + "\n" +
+				`    IF                   matched "if"` + "\n" +
+				`" " at 1:3 is skip "( |\\n)+" (only candidate)` + "\n" +
+				"  candidates:\n" +
+				`    skip "( |\\n)+"      matched " "` + "\n" +
+				`"1" at 1:4 is NUMBER (only candidate)` + "\n" +
+				"  candidates:\n" +
+				`    NUMBER               matched "1"` + "\n",
+		},
+		{
+			args: []string{"explain", "--nfa", "-p", "[0-9]+", "-e", "12"},
+			want: `"12" at 1:1 is [0-9]+ (only candidate)` + "\n" +
+				"  path:\n" +
+				"    start in state 1\n" +
+				"    read '1' -> state 1\n" +
+				`    accept "1" as [0-9]+` + "\n" +
+				"    read '2' -> state 1\n" +
+				`    accept "12" as [0-9]+` + "\n" +
+				"  candidates:\n" +
+				`    [0-9]+               matched "12"` + "\n",
+		},
+		{
+			args: []string{"explain", "--no-path", "--set-ops", "-t", "ID=[a-z]+--if", "-t", "IF=if", "-t", `AND=\&\&`, "-e", "if&&"},
+			want: `"if" at 1:1 is IF (longest match)` + "\n" +
+				"  candidates:\n" +
+				`    IF                   matched "if"` + "\n" +
+				`    ID                   matched "i"` + "\n" +
+				`"&&" at 1:3 is AND (only candidate)` + "\n" +
+				"  candidates:\n" +
+				`    AND                  matched "&&"` + "\n",
+		},
+		{
+			args: []string{"explain", "--no-path", "-t", "AND=&&", "-e", "&&"},
+			want: `"&&" at 1:1 is AND (only candidate)` + "\n" +
+				"  candidates:\n" +
+				`    AND                  matched "&&"` + "\n",
+		},
+		{
+			args: []string{"overlaps", "-f", "spec"},
+			want: `ID shadows IF (both match "if")` + "\n",
+		},
+		{
+			args: []string{"overlaps", "-p", "[a-z]+", "-p", "[a-c0-9]+"},
+			want: `[a-z]+ and [a-c0-9]+ both match "a" ([a-z]+ wins)` + "\n",
+		},
+		{
+			args: []string{"dot", "-f", "spec"},
+			want: "digraph DFA {\n" +
+				`[style=bold, peripheries=2, xlabel="ID"]` + "\n" +
+				`[style=bold, peripheries=2, xlabel="NUMBER"]` + "\n" +
+				`[label="a-z"]` + "\n" +
+				`[label="0-9"]` + "\n",
+			someLines: true,
+		},
+		{
+			args: []string{"dot", "--dfa", "-p", "a|b"},
+			want: "digraph DFA {\n" +
+				`[style=bold, peripheries=2, xlabel="a|b"]` + "\n",
+			someLines: true,
+		},
+		{
+			args: []string{"dot", "--nfa", "-t", "AB=ab"},
+			want: "digraph NFA {\n" +
+				`[label="a"]` + "\n" +
+				`[label="b"]` + "\n" +
+				`xlabel="AB"` + "\n",
+			someLines: true,
+		},
+		{
+			// the NFA of set operators is translated from the DFA
+			args: []string{"dot", "--nfa", "--set-ops", "-t", "ID=[a-z]+--if", "-p", "if"},
+			want: "digraph NFA {\n" +
+				`[label="a-h"]` + "\n" +
+				`[label="j-z"]` + "\n" +
+				`xlabel="ID"` + "\n" +
+				`xlabel="if"` + "\n",
+			someLines: true,
+		},
+	}
+	for _, tc := range tests {
+		out := run(t, dir, tc.args)
+		if !tc.someLines {
+			t.Assert(out == tc.want, "%v: expected\n%s\ngot\n%s", tc.args, tc.want, out)
+			continue
+		}
+		for _, line := range strings.Split(strings.TrimSpace(tc.want), "\n") {
+			t.Assert(strings.Contains(out, line), "%v: expected %q in\n%s", tc.args, line, out)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+import (
+	"github.com/timtadh/lexmachine"
+	"github.com/timtadh/lexmachine/machines"
+)
+
+// lexerShort and lexerLong are the getopt options which describe a lexer.
+// They are shared by the subcommands which lex text.
+var lexerShort = "p:t:s:f:"
+var lexerLong = []string{
+	"pattern=",
+	"token=",
+	"skip=",
+	"spec=",
+	"nfa",
+	"set-ops",
+}
+
+var lexerMessage = `
+Lexer Options
+    -p, --pattern=<pattern>             a token pattern (named by the pattern)
+    -t, --token=<name>=<pattern>        a named token pattern
+    -s, --skip=<pattern>                a pattern whose matches are skipped
+    -f, --spec=<file>                   read patterns from a spec file
+    --nfa                               use the NFA engine (default is DFA)
+    --set-ops                           enable the set operators & (and), --
+                                        (and not) and ~ (not) in the patterns
+
+    Tokens are numbered in the order they are given starting from 0. When
+    several patterns match the same text the one given first wins.
+
+    A spec file has one pattern per line: a name, white space and the
+    pattern. Patterns named _ are skipped. Blank lines and lines starting
+    with # are ignored. eg.
+
+        # a tiny lexer
+        ID      [a-zA-Z_][a-zA-Z0-9_]*
+        NUMBER  [0-9]+
+        _       ( |\t|\n)+
+`
+
+// lexerSpec collects the lexer options from the command line.
+type lexerSpec struct {
+	names    []string
+	patterns []string
+	skip     []bool
+	nfa      bool
+	setOps   bool
+}
+
+// option records the lexer option opt with the argument arg. It returns false
+// if opt is not a lexer option.
+func (s *lexerSpec) option(opt, arg string) (bool, error) {
+	switch opt {
+	case "-p", "--pattern":
+		s.add(arg, arg, false)
+	case "-t", "--token":
+		i := strings.Index(arg, "=")
+		if i <= 0 {
+			return true, fmt.Errorf("expected <name>=<pattern> got %q", arg)
+		}
+		s.add(arg[:i], arg[i+1:], false)
+	case "-s", "--skip":
+		s.add("_", arg, true)
+	case "-f", "--spec":
+		return true, s.load(arg)
+	case "--nfa":
+		s.nfa = true
+	case "--set-ops":
+		s.setOps = true
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+func (s *lexerSpec) add(name, pattern string, skip bool) {
+	s.names = append(s.names, name)
+	s.patterns = append(s.patterns, pattern)
+	s.skip = append(s.skip, skip)
+}
+
+// load the patterns in the spec file named path.
+func (s *lexerSpec) load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	lines := bufio.NewScanner(f)
+	for n := 1; lines.Scan(); n++ {
+		line := strings.TrimSpace(lines.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.IndexAny(line, " \t")
+		if i < 0 {
+			return fmt.Errorf("%s:%d: expected <name> <pattern> got %q", path, n, line)
+		}
+		name, pattern := line[:i], strings.TrimSpace(line[i:])
+		s.add(name, pattern, name == "_")
+	}
+	return lines.Err()
+}
+
+// name returns the name of the token type typ.
+func (s *lexerSpec) name(typ int) string {
+	return s.names[typ]
+}
+
+// labels returns a label for each pattern: the name of the token or the
+// pattern if the token was not named.
+func (s *lexerSpec) labels() []string {
+	labels := make([]string, 0, len(s.names))
+	for i, name := range s.names {
+		if s.skip[i] {
+			name = "skip " + strconv.Quote(s.patterns[i])
+		}
+		labels = append(labels, name)
+	}
+	return labels
+}
+
+// tokenType finds the token type of a token given by name or number.
+func (s *lexerSpec) tokenType(name string) (int, error) {
+	for i, n := range s.names {
+		if n == name && !s.skip[i] {
+			return i, nil
+		}
+	}
+	if i, err := strconv.Atoi(name); err == nil && i >= 0 && i < len(s.names) {
+		return i, nil
+	}
+	return 0, fmt.Errorf("unknown token %q", name)
+}
+
+// lexer compiles the lexer. The Type of a Token is the index of its pattern.
+func (s *lexerSpec) lexer() (*lexmachine.Lexer, error) {
+	lexer, err := s.uncompiled()
+	if err != nil {
+		return nil, err
+	}
+	if s.nfa {
+		err = lexer.CompileNFA()
+	} else {
+		err = lexer.CompileDFA()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return lexer, nil
+}
+
+// uncompiled is the lexer before it is compiled (see lexer).
+func (s *lexerSpec) uncompiled() (*lexmachine.Lexer, error) {
+	if len(s.patterns) <= 0 {
+		return nil, fmt.Errorf("Must supply some regulars expressions!")
+	}
+	lexer := lexmachine.NewLexer()
+	add := lexer.Add
+	if s.setOps {
+		add = lexer.AddSetOps
+	}
+	for i, pattern := range s.patterns {
+		typ := i
+		if s.skip[i] {
+			add([]byte(pattern), func(*lexmachine.Scanner, *machines.Match) (interface{}, error) {
+				return nil, nil
+			})
+		} else {
+			add([]byte(pattern), func(scan *lexmachine.Scanner, m *machines.Match) (interface{}, error) {
+				return scan.Token(typ, string(m.Bytes), m), nil
+			})
+		}
+	}
+	return lexer, nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
 	logpkg "log"
 	"os"
 )
@@ -20,7 +21,7 @@ func init() {
 	log = logpkg.New(os.Stderr, "", 0)
 }
 
-var usageMessage = "lexc -p <pattern> [-p <pattern>]*"
+var usageMessage = "lexc -p <pattern> [-p <pattern>]*\n       lexc <command> [options]"
 var extendedMessage = `
 lexc compiles regular expressions to a program suitable for lexing
 
@@ -28,11 +29,30 @@ Options
     -h, --help                          print this message
     -p, --pattern=<pattern>             a regex pattern
 
+Commands
+    dot                                 print the NFA or DFA as Graphviz source
+    explain                             explain how each token was matched
+    highlight                           print a file highlighted by token
+    overlaps                            print the patterns matching the same text
+    tokenize                            print the tokens of files
+
+    Run lexc <command> --help for the options of a command.
+
 Specs
     <pattern>
         a regex pattern
 `
 
+// commands are the subcommands of lexc. Without a command lexc compiles the
+// patterns to a program.
+var commands = map[string]func(args []string){
+	"dot":       dotCmd,
+	"explain":   explainCmd,
+	"highlight": highlightCmd,
+	"overlaps":  overlapsCmd,
+	"tokenize":  tokenizeCmd,
+}
+
 func usage(code int) {
 	fmt.Fprintln(os.Stderr, usageMessage)
 	if code == 0 {
@@ -44,7 +64,36 @@ func usage(code int) {
 	os.Exit(code)
 }
 
+// subUsage prints the usage of a subcommand and exits.
+func subUsage(usage, message string, code int) {
+	fmt.Fprintln(os.Stderr, usage)
+	if code == 0 {
+		fmt.Fprintln(os.Stderr, message)
+		code = 1
+	} else {
+		fmt.Fprintln(os.Stderr, "Try -h or --help for help")
+	}
+	os.Exit(code)
+}
+
+// readInput reads the file named by the arguments (or stdin if there are
+// none).
+func readInput(args []string) ([]byte, error) {
+	if len(args) > 1 {
+		return nil, fmt.Errorf("expected at most one file got %v", args)
+	} else if len(args) == 1 && args[0] != "-" {
+		return ioutil.ReadFile(args[0])
+	}
+	return ioutil.ReadAll(os.Stdin)
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, has := commands[os.Args[1]]; has {
+			cmd(os.Args[2:])
+			return
+		}
+	}
 
 	short := "hp:"
 	long := []string{
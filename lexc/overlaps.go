@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+)
+
+import (
+	"github.com/timtadh/getopt"
+)
+
+var overlapsUsage = "lexc overlaps [options]"
+var overlapsMessage = `
+lexc overlaps prints every pair of patterns which can match the same lexeme
+with a shortest such lexeme. When both match the pattern given first wins.
+A pattern which is shadowed (every lexeme it matches is matched by a pattern
+given before it) never produces a token.
+
+Options
+    -h, --help                          print this message
+    --shadowed                          only print the shadowed patterns and
+                                        exit with status 1 if there are any
+` + lexerMessage
+
+func overlapsCmd(args []string) {
+	short := "h" + lexerShort
+	long := append([]string{
+		"help",
+		"shadowed",
+	}, lexerLong...)
+
+	_, optargs, err := getopt.GetOpt(args, short, long)
+	if err != nil {
+		log.Print(err)
+		subUsage(overlapsUsage, overlapsMessage, 1)
+	}
+
+	spec := new(lexerSpec)
+	onlyShadowed := false
+	for _, oa := range optargs {
+		switch oa.Opt() {
+		case "-h", "--help":
+			subUsage(overlapsUsage, overlapsMessage, 0)
+		case "--shadowed":
+			onlyShadowed = true
+		default:
+			if _, err := spec.option(oa.Opt(), oa.Arg()); err != nil {
+				log.Print(err)
+				subUsage(overlapsUsage, overlapsMessage, 1)
+			}
+		}
+	}
+
+	lexer, err := spec.lexer()
+	if err != nil {
+		log.Print(err)
+		subUsage(overlapsUsage, overlapsMessage, 1)
+	}
+	overlaps, err := lexer.Overlaps()
+	if err != nil {
+		log.Fatal(err)
+	}
+	labels := spec.labels()
+	shadowed := false
+	for _, o := range overlaps {
+		if o.Shadowed {
+			shadowed = true
+			fmt.Printf("%s shadows %s (both match %q)\n", labels[o.A], labels[o.B], o.Witness)
+		} else if !onlyShadowed {
+			fmt.Printf("%s and %s both match %q (%s wins)\n", labels[o.A], labels[o.B], o.Witness, labels[o.A])
+		}
+	}
+	if onlyShadowed && shadowed {
+		log.Fatal("some patterns are shadowed")
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+)
+
+import (
+	"github.com/timtadh/getopt"
+)
+
+import (
+	"github.com/timtadh/lexmachine"
+)
+
+var tokenizeUsage = "lexc tokenize [options] [<file>]*"
+var tokenizeMessage = `
+lexc tokenize lexes files (or stdin) and prints their tokens
+
+Options
+    -h, --help                          print this message
+    -o, --format=<format>               the output format (default table)
+` + lexerMessage + `
+Specs
+    <format>
+        table   an aligned table with a row per token
+        json    a JSON object per line per token with the fields file, token,
+                type, lexeme, start, end, start_line, start_column, end_line
+                and end_column
+        csv     the fields of json as CSV with a header row
+
+    Byte offsets are zero based with the end exclusive. Lines and columns
+    are one based with the end inclusive.
+`
+
+// tokenRow is a token as it is printed by tokenize.
+type tokenRow struct {
+	File        string `json:"file"`
+	Token       string `json:"token"`
+	Type        int    `json:"type"`
+	Lexeme      string `json:"lexeme"`
+	Start       int    `json:"start"`
+	End         int    `json:"end"`
+	StartLine   int    `json:"start_line"`
+	StartColumn int    `json:"start_column"`
+	EndLine     int    `json:"end_line"`
+	EndColumn   int    `json:"end_column"`
+}
+
+// tokenWriter prints tokens in one of the output formats.
+type tokenWriter interface {
+	Write(row *tokenRow) error
+	Flush() error
+}
+
+func tokenizeCmd(args []string) {
+	short := "ho:" + lexerShort
+	long := append([]string{
+		"help",
+		"format=",
+	}, lexerLong...)
+
+	files, optargs, err := getopt.GetOpt(args, short, long)
+	if err != nil {
+		log.Print(err)
+		subUsage(tokenizeUsage, tokenizeMessage, 1)
+	}
+
+	spec := new(lexerSpec)
+	format := "table"
+	for _, oa := range optargs {
+		if isLexerOpt, err := spec.option(oa.Opt(), oa.Arg()); err != nil {
+			log.Print(err)
+			subUsage(tokenizeUsage, tokenizeMessage, 1)
+		} else if isLexerOpt {
+			continue
+		}
+		switch oa.Opt() {
+		case "-h", "--help":
+			subUsage(tokenizeUsage, tokenizeMessage, 0)
+		case "-o", "--format":
+			format = oa.Arg()
+		}
+	}
+
+	var out tokenWriter
+	switch format {
+	case "table":
+		out = newTableWriter(os.Stdout)
+	case "json":
+		out = &jsonWriter{json.NewEncoder(os.Stdout)}
+	case "csv":
+		out = newCSVWriter(os.Stdout)
+	default:
+		log.Printf("unknown format %q", format)
+		subUsage(tokenizeUsage, tokenizeMessage, 1)
+	}
+
+	lexer, err := spec.lexer()
+	if err != nil {
+		log.Print(err)
+		subUsage(tokenizeUsage, tokenizeMessage, 1)
+	}
+
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	failed := false
+	for _, file := range files {
+		if err := tokenize(lexer, spec, file, out); err != nil {
+			// print the tokens before the error
+			out.Flush()
+			log.Printf("%s: %v", file, err)
+			failed = true
+		}
+	}
+	if err := out.Flush(); err != nil {
+		log.Fatal(err)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// tokenize lexes the file and writes its tokens to out. It stops at the first
+// lexing error.
+func tokenize(lexer *lexmachine.Lexer, spec *lexerSpec, file string, out tokenWriter) error {
+	text, err := readInput([]string{file})
+	if err != nil {
+		return err
+	}
+	scanner, err := lexer.Scanner(text)
+	if err != nil {
+		return err
+	}
+	for tok, err, eos := scanner.Next(); !eos; tok, err, eos = scanner.Next() {
+		if err != nil {
+			return err
+		}
+		t := tok.(*lexmachine.Token)
+		err := out.Write(&tokenRow{
+			File:        file,
+			Token:       spec.name(t.Type),
+			Type:        t.Type,
+			Lexeme:      string(t.Lexeme),
+			Start:       t.TC,
+			End:         t.TC + len(t.Lexeme),
+			StartLine:   t.StartLine,
+			StartColumn: t.StartColumn,
+			EndLine:     t.EndLine,
+			EndColumn:   t.EndColumn,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type tableWriter struct {
+	w      *tabwriter.Writer
+	header bool
+}
+
+func newTableWriter(w io.Writer) *tableWriter {
+	return &tableWriter{w: tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)}
+}
+
+func (t *tableWriter) Write(row *tokenRow) error {
+	if !t.header {
+		t.header = true
+		if _, err := fmt.Fprintln(t.w, "FILE\tTOKEN\tLEXEME\tOFFSETS\tPOSITION"); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(t.w, "%s\t%s\t%q\t%d-%d\t%d:%d-%d:%d\n",
+		row.File, row.Token, row.Lexeme, row.Start, row.End,
+		row.StartLine, row.StartColumn, row.EndLine, row.EndColumn)
+	return err
+}
+
+func (t *tableWriter) Flush() error {
+	return t.w.Flush()
+}
+
+type jsonWriter struct {
+	enc *json.Encoder
+}
+
+func (j *jsonWriter) Write(row *tokenRow) error {
+	return j.enc.Encode(row)
+}
+
+func (j *jsonWriter) Flush() error {
+	return nil
+}
+
+type csvWriter struct {
+	w      *csv.Writer
+	header bool
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) Write(row *tokenRow) error {
+	if !c.header {
+		c.header = true
+		err := c.w.Write([]string{"file", "token", "type", "lexeme", "start", "end", "start_line", "start_column", "end_line", "end_column"})
+		if err != nil {
+			return err
+		}
+	}
+	itoa := strconv.Itoa
+	return c.w.Write([]string{
+		row.File, row.Token, itoa(row.Type), row.Lexeme, itoa(row.Start), itoa(row.End),
+		itoa(row.StartLine), itoa(row.StartColumn), itoa(row.EndLine), itoa(row.EndColumn),
+	})
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
@@ -2,7 +2,11 @@ package lexmachine
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"go/token"
+	"sync"
+	"time"
 )
 
 import (
@@ -33,6 +37,7 @@ type Token struct {
 	StartColumn int
 	EndLine     int
 	EndColumn   int
+	Pos         token.Pos // NoPos unless the Scanner was created WithFileSet
 }
 
 // Equals checks the equality of two tokens ignoring the Value field.
@@ -67,8 +72,18 @@ func (t *Token) String() string {
 type Action func(scan *Scanner, match *machines.Match) (interface{}, error)
 
 type pattern struct {
-	regex  []byte
-	action Action
+	regex    []byte
+	action   Action
+	shortest bool // match the shortest lexeme (see AddShortest)
+	setOps   bool // the regex may use the set operators (see AddSetOps)
+}
+
+// parse the regex of the pattern.
+func (p *pattern) parse() (frontend.AST, error) {
+	if p.setOps {
+		return frontend.ParseSetOps(p.regex)
+	}
+	return frontend.Parse(p.regex)
 }
 
 // Lexer is a "builder" object which lets you construct a Scanner type which
@@ -76,12 +91,37 @@ type pattern struct {
 // string.  Get a new Lexer by calling the NewLexer() function. Add patterns to
 // match (with their callbacks) by using the Add function. Finally, construct a
 // scanner with Scanner to tokenizing a byte string.
+//
+// The methods of a Lexer are safe to call from multiple goroutines. However,
+// as a Lexer may be changed by Add, creating a Scanner from it takes a lock.
+// To share a lexer between many goroutines without locking use Compiled to
+// get an immutable CompiledLexer.
 type Lexer struct {
+	mu         sync.Mutex
 	patterns   []*pattern
 	nfaMatches map[int]int // match_idx -> pat_idx
 	dfaMatches map[int]int // match_idx -> pat_idx
 	program    inst.Slice
 	dfa        *dfapkg.DFA
+	eof        Action
+	compiled   *CompiledLexer
+}
+
+// CompiledLexer is an immutable compiled lexer produced by Lexer.Compiled.
+// As it never changes it may be shared by any number of goroutines, each
+// creating their own Scanners from it without taking any locks.
+type CompiledLexer struct {
+	patterns []*pattern
+	matches  map[int]int  // match_idx -> pat_idx
+	shortest map[int]bool // the match_idxs of the shortest match patterns
+	program  inst.Slice   // the NFA program (if compiled to an NFA)
+	dfa      *dfapkg.DFA  // the DFA (if compiled to a DFA)
+	eof      Action       // the action run at the end of the text (see OnEOF)
+
+	// a DFA for each pattern used to explain matches (see WithExplain)
+	explainOnce sync.Once
+	explainDFAs []*dfapkg.DFA
+	explainErr  error
 }
 
 // Scanner tokenizes a byte string based on the patterns provided to the lexer
@@ -106,16 +146,32 @@ type Lexer struct {
 //     }
 //
 type Scanner struct {
-	lexer   *Lexer
-	matches map[int]int
-	scan    machines.Scanner
-	Text    []byte
-	TC      int
-	pTC     int
-	sLine   int
-	sColumn int
-	eLine   int
-	eColumn int
+	lexer    *CompiledLexer
+	matches  map[int]int
+	scan     machines.Scanner
+	config   machines.Config
+	copyText bool
+	fset     *token.FileSet
+	filename string
+	file     *token.File
+	call     call            // the extent of the last call to Next
+	record   bool            // the calls are recorded (by a TokenStream) even without limits
+	match    *machines.Match // the match passed to the running Action (see Consume)
+	atEOF    bool            // the OnEOF action has run (or must not run)
+	ctx      context.Context
+	limits   Limits
+	tokens   int       // the number of tokens returned by Next
+	started  time.Time // when the engine started matching the current token
+	explain  func(*Explanation)
+	path     []machines.TraceEvent
+	deferred *deferral // the heredoc bodies skipped at the end of the line (see HeredocConfig.Lines)
+	Text     []byte
+	TC       int
+	pTC      int
+	sLine    int
+	sColumn  int
+	eLine    int
+	eColumn  int
 }
 
 // Next iterates through the string being scanned returning one token at a time
@@ -141,33 +197,186 @@ type Scanner struct {
 // For more information on functional iterators see:
 // http://hackthology.com/functional-iteration-in-go.html
 func (s *Scanner) Next() (tok interface{}, err error, eos bool) {
+	if s.plain() {
+		return s.nextPlain()
+	}
+	s.call = call{tc: s.TC, lookahead: s.TC, deferred: s.deferred != nil}
+	if err := s.checkLimits(); err != nil {
+		return nil, err, false
+	}
+	tok, err, eos = s.next()
+	if tok != nil {
+		if err := s.countToken(); err != nil {
+			return nil, err, false
+		}
+	}
+	return tok, err, eos
+}
+
+// next scans the next token for Next.
+func (s *Scanner) next() (tok interface{}, err error, eos bool) {
 	var token interface{}
 	for token == nil {
-		tc, match, err, scan := s.scan(s.TC)
+		s.skipDeferred()
+		if s.limits.MaxTokenTime > 0 {
+			s.started = time.Now()
+		}
+		engine, buffers := s.scan, s.config.Buffers
+		if s.deferred != nil {
+			engine, buffers = s.deferred.scan, s.deferred.config.Buffers
+		}
+		tc, match, err, scan := engine(s.TC)
+		s.call.examined(len(s.Text), match, err, buffers)
 		if scan == nil {
-			return nil, nil, true
+			return s.eof()
 		} else if err != nil {
-			return nil, err, false
+			return nil, s.positionError(err), false
 		} else if match == nil {
 			return nil, fmt.Errorf("No match but no error"), false
 		}
-		s.scan = scan
-		s.pTC = s.TC
-		s.TC = tc
-		s.sLine = match.StartLine
-		s.sColumn = match.StartColumn
-		s.eLine = match.EndLine
-		s.eColumn = match.EndColumn
+		if s.deferred != nil {
+			s.deferred.scan = scan
+		} else {
+			s.scan = scan
+		}
+		s.matched(tc, match)
+		if s.explain != nil {
+			if err := s.explainMatch(match); err != nil {
+				return nil, err, false
+			}
+		}
 
 		pattern := s.lexer.patterns[s.matches[match.PC]]
+		s.match = match
 		token, err = pattern.action(s, match)
+		s.match = nil
 		if err != nil {
 			return nil, err, false
+		} else if token == nil {
+			if err := s.canceled(); err != nil {
+				return nil, err, false
+			}
 		}
 	}
+	s.skipDeferred()
 	return token, nil, false
 }
 
+// plain returns true if Next has no bookkeeping to do: the scanner has no
+// context, limits, deferred heredoc bodies or explain function and the calls
+// to Next are not recorded.
+func (s *Scanner) plain() bool {
+	return s.ctx == nil && s.limits == (Limits{}) && s.deferred == nil && s.explain == nil && !s.record
+}
+
+// nextPlain is next without the bookkeeping (see plain). It hands the scan
+// over to next when an Action defers a heredoc body.
+func (s *Scanner) nextPlain() (tok interface{}, err error, eos bool) {
+	for {
+		tc, match, err, scan := s.scan(s.TC)
+		if scan == nil {
+			return s.eof()
+		} else if err != nil {
+			return nil, s.positionError(err), false
+		} else if match == nil {
+			return nil, fmt.Errorf("No match but no error"), false
+		}
+		s.scan = scan
+		s.matched(tc, match)
+
+		pattern := s.lexer.patterns[s.matches[match.PC]]
+		s.match = match
+		token, err := pattern.action(s, match)
+		s.match = nil
+		if err != nil {
+			return nil, err, false
+		} else if s.deferred != nil {
+			if token == nil {
+				return s.next()
+			}
+			s.skipDeferred()
+		}
+		if token != nil {
+			return token, nil, false
+		}
+	}
+}
+
+// matched moves the scanner to tc after the engine found match.
+func (s *Scanner) matched(tc int, match *machines.Match) {
+	s.pTC = s.TC
+	s.TC = tc
+	s.sLine = match.StartLine
+	s.sColumn = match.StartColumn
+	s.eLine = match.EndLine
+	s.eColumn = match.EndColumn
+	match.Pos = s.pos(match.TC)
+}
+
+// eof runs the OnEOF action (once) when the scanner reaches the end of the
+// text.
+func (s *Scanner) eof() (tok interface{}, err error, eos bool) {
+	if s.lexer.eof == nil || s.atEOF {
+		return nil, nil, true
+	}
+	s.atEOF = true
+	end := len(s.Text)
+	line, col := s.config.Buffers.EndLineCol()
+	match := &machines.Match{
+		PC:          -1,
+		TC:          end,
+		StartLine:   line,
+		StartColumn: col,
+		EndLine:     line,
+		EndColumn:   col,
+		Bytes:       s.Text[end:],
+		Pos:         s.pos(end),
+	}
+	if s.call.line == 0 {
+		s.call.line, s.call.column = line, col
+	}
+	s.pTC = s.TC
+	s.TC = end
+	s.match = match
+	tok, err = s.lexer.eof(s, match)
+	s.match = nil
+	if err != nil {
+		return nil, err, false
+	} else if tok == nil {
+		return nil, nil, true
+	}
+	return tok, nil, false
+}
+
+// call records the extent of the text examined by a call to Next.
+type call struct {
+	tc           int  // the text counter Next started at
+	deferred     bool // heredoc bodies were deferred to the end of the line when Next started
+	lookahead    int  // one past the last byte examined (len(text)+1 if it reached the end)
+	line, column int  // the position of tc (0, 0 if no match was found)
+}
+
+// examined extends the call by the bytes examined to find match (or err, or
+// the end of the text if both are nil) in a text of length n by the engine
+// using buffers.
+func (c *call) examined(n int, match *machines.Match, err error, buffers *machines.Buffers) {
+	lookahead := n + 1
+	if match != nil {
+		lookahead = buffers.Lookahead()
+		if c.line == 0 {
+			c.line, c.column = match.StartLine, match.StartColumn
+		}
+	} else if u, is := err.(*machines.UnconsumedInput); is {
+		lookahead = u.FailTC
+	}
+	if lookahead >= n {
+		lookahead = n + 1
+	}
+	if lookahead > c.lookahead {
+		c.lookahead = lookahead
+	}
+}
+
 // Token is a helper function for constructing a Token type inside of a Action.
 func (s *Scanner) Token(typ int, value interface{}, m *machines.Match) *Token {
 	return &Token{
@@ -179,6 +388,130 @@ func (s *Scanner) Token(typ int, value interface{}, m *machines.Match) *Token {
 		StartColumn: m.StartColumn,
 		EndLine:     m.EndLine,
 		EndColumn:   m.EndColumn,
+		Pos:         m.Pos,
+	}
+}
+
+// ExtendMatch changes the match m to end at the text counter end (exclusive)
+// and moves the scanner there so scanning resumes after it. It updates the
+// Bytes, EndLine and EndColumn of the match with the line and column tables
+// of the lexing engine (so the positions respect WithColumns, WithTabWidth
+// and WithNewlines). An Action which consumes text beyond its match should
+// use it instead of moving TC itself. It may also shorten the match. An end
+// past the end of the text is the end of the text. ExtendMatch returns an
+// error (and leaves the match and the scanner unchanged) if end is not after
+// the start of the match.
+func (s *Scanner) ExtendMatch(m *machines.Match, end int) error {
+	if end > len(s.Text) {
+		end = len(s.Text)
+	}
+	if end <= m.TC {
+		return fmt.Errorf("ExtendMatch: the end %d is not after the start of the match %d", end, m.TC)
+	}
+	m.Bytes = s.Text[m.TC:end]
+	m.EndLine, m.EndColumn = s.config.Buffers.LineCol(end - 1)
+	s.TC = end
+	return nil
+}
+
+// Consume extends the match passed to the running Action by the next n bytes
+// of the text (see ExtendMatch) and returns them. Fewer bytes are consumed at
+// the end of the text. Consume returns an error (and consumes nothing) if it
+// is not called from an Action or if n is negative.
+func (s *Scanner) Consume(n int) ([]byte, error) {
+	if s.match == nil {
+		return nil, fmt.Errorf("Consume may only be called from an Action")
+	} else if n < 0 {
+		return nil, fmt.Errorf("Consume: can not consume %d bytes", n)
+	}
+	start := s.TC
+	if err := s.ExtendMatch(s.match, s.TC+n); err != nil {
+		return nil, err
+	}
+	return s.Text[start:s.TC], nil
+}
+
+// LineCol computes the line and column of the text counter tc the same way
+// the scanner computes the positions of its matches (so they respect
+// WithColumns, WithTabWidth and WithNewlines). The end of the text is
+// reported as the position just past its last byte.
+func (s *Scanner) LineCol(tc int) (line, col int) {
+	if tc >= len(s.Text) {
+		return s.config.Buffers.EndLineCol()
+	}
+	return s.config.Buffers.LineCol(tc)
+}
+
+// File returns the token.File registered for the text under scan (see
+// WithFileSet). It is nil if no file was registered.
+func (s *Scanner) File() *token.File {
+	return s.file
+}
+
+// pos converts a text counter into a token.Pos. It returns token.NoPos if no
+// file has been registered.
+func (s *Scanner) pos(tc int) token.Pos {
+	if s.file == nil || tc < 0 || tc > s.file.Size() {
+		return token.NoPos
+	}
+	return s.file.Pos(tc)
+}
+
+// positionError fills in the token.Pos fields of the errors returned by the
+// lexing engines.
+func (s *Scanner) positionError(err error) error {
+	switch e := err.(type) {
+	case *machines.UnconsumedInput:
+		e.StartPos = s.pos(e.StartTC)
+		e.FailPos = s.pos(e.FailTC)
+	case *machines.EmptyMatchError:
+		e.Pos = s.pos(e.TC)
+	}
+	return err
+}
+
+// A ScannerOption configures a Scanner when it is created by Lexer.Scanner.
+type ScannerOption func(*Scanner)
+
+// WithFileSet registers the text under scan with fset as a file named
+// filename. The Pos fields of the produced machines.Match, Token and error
+// values are then set to positions in the file so they can be formatted with
+// fset.Position like any other go/token position:
+//
+//     fset := token.NewFileSet()
+//     scanner, err := lexer.Scanner(text, lexmachine.WithFileSet(fset, "a.dot"))
+//     ...
+//     tok := t.(*lexmachine.Token)
+//     fmt.Printf("%v: %s\n", fset.Position(tok.Pos), tok.Lexeme)
+//
+func WithFileSet(fset *token.FileSet, filename string) ScannerOption {
+	return func(s *Scanner) {
+		s.fset = fset
+		s.filename = filename
+	}
+}
+
+// WithColumns selects what the column numbers reported by the Scanner count:
+// bytes (the default), runes or UTF-16 code units.
+func WithColumns(unit machines.ColumnUnit) ScannerOption {
+	return func(s *Scanner) {
+		s.config.Positions.Columns = unit
+	}
+}
+
+// WithTabWidth expands tabs to the next multiple of width when computing
+// columns. By default a tab is a single column.
+func WithTabWidth(width int) ScannerOption {
+	return func(s *Scanner) {
+		s.config.Positions.TabWidth = width
+	}
+}
+
+// WithNewlines selects the line endings recognized when computing lines. By
+// default only \n ends a line.
+func WithNewlines(newlines machines.Newlines) ScannerOption {
+	return func(s *Scanner) {
+		s.config.Positions.Newlines = newlines
 	}
 }
 
@@ -187,48 +520,253 @@ func NewLexer() *Lexer {
 	return &Lexer{}
 }
 
-// Scanner creates a scanner for a particular byte string from the lexer.
-func (l *Lexer) Scanner(text []byte) (*Scanner, error) {
+// Scanner creates a scanner for a particular byte string from the lexer. The
+// scanner may be configured with ScannerOptions such as WithFileSet.
+func (l *Lexer) Scanner(text []byte, options ...ScannerOption) (*Scanner, error) {
+	c, err := l.Compiled()
+	if err != nil {
+		return nil, err
+	}
+	return c.Scanner(text, options...)
+}
+
+// ScannerNoCopy creates a scanner which scans text directly rather than a
+// copy of it (as Scanner does). This saves an allocation and a copy per
+// scanner. The caller must not modify text until it is done with the scanner
+// and the tokens produced from it (the Lexemes of the tokens are slices of
+// text).
+func (l *Lexer) ScannerNoCopy(text []byte, options ...ScannerOption) (*Scanner, error) {
+	c, err := l.Compiled()
+	if err != nil {
+		return nil, err
+	}
+	return c.ScannerNoCopy(text, options...)
+}
+
+// Compiled returns an immutable CompiledLexer for the patterns added so far,
+// compiling them to a DFA if neither CompileDFA nor CompileNFA has been
+// called. Patterns added after calling Compiled do not affect the
+// CompiledLexer it returned.
+func (l *Lexer) Compiled() (*CompiledLexer, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	if l.program == nil && l.dfa == nil {
-		err := l.Compile()
+		err := l.compileDFA()
 		if err != nil {
 			return nil, err
 		}
 	}
+	if l.compiled == nil {
+		l.compiled = l.snapshot()
+	}
+	return l.compiled, nil
+}
 
-	// prevent the user from modifying the text under scan
-	textCopy := make([]byte, len(text))
-	copy(textCopy, text)
-
-	var s *Scanner
+// snapshot captures the current compiled state of the lexer. It prefers the
+// DFA if both a DFA and an NFA have been compiled.
+func (l *Lexer) snapshot() *CompiledLexer {
+	c := &CompiledLexer{
+		patterns: make([]*pattern, len(l.patterns)),
+	}
+	copy(c.patterns, l.patterns)
 	if l.dfa != nil {
-		s = &Scanner{
-			lexer:   l,
-			matches: l.dfaMatches,
-			scan:    machines.DFALexerEngine(l.dfa.Start, l.dfa.Error, l.dfa.Trans, l.dfa.Accepting, textCopy),
-			Text:    textCopy,
-			TC:      0,
-		}
+		c.dfa = l.dfa
+		c.matches = l.dfaMatches
 	} else {
-		s = &Scanner{
-			lexer:   l,
-			matches: l.nfaMatches,
-			scan:    machines.LexerEngine(l.program, textCopy),
-			Text:    textCopy,
-			TC:      0,
+		c.program = l.program
+		c.matches = l.nfaMatches
+	}
+	c.eof = l.eof
+	for idx, pat := range c.matches {
+		if c.patterns[pat].shortest {
+			if c.shortest == nil {
+				c.shortest = make(map[int]bool)
+			}
+			c.shortest[idx] = true
 		}
 	}
+	return c
+}
+
+// Scanner creates a scanner for a particular byte string from the compiled
+// lexer. The scanner may be configured with ScannerOptions such as
+// WithFileSet.
+func (c *CompiledLexer) Scanner(text []byte, options ...ScannerOption) (*Scanner, error) {
+	return c.scanner(text, true, options)
+}
+
+// ScannerNoCopy creates a scanner which scans text directly rather than a
+// copy of it. See Lexer.ScannerNoCopy.
+func (c *CompiledLexer) ScannerNoCopy(text []byte, options ...ScannerOption) (*Scanner, error) {
+	return c.scanner(text, false, options)
+}
+
+// scanner creates a scanner for text. It returns a *LimitError (before
+// copying text) if text is longer than the MaxBytes limit of the options.
+func (c *CompiledLexer) scanner(text []byte, copyText bool, options []ScannerOption) (*Scanner, error) {
+	s := &Scanner{
+		lexer:    c,
+		matches:  c.matches,
+		copyText: copyText,
+	}
+	for _, option := range options {
+		option(s)
+	}
+	if s.tooLong(text) {
+		return nil, s.limitError(ByteLimit, 0)
+	}
+	if s.explain != nil {
+		s.config.Trace = s.trace
+	}
+	if s.ctx != nil || s.limits.MaxTokenTime > 0 {
+		s.config.Interrupt = s.interrupt
+	}
+	s.config.Buffers = &machines.Buffers{}
+	s.Reset(text)
 	return s, nil
 }
 
+// Reset the scanner to scan text from the beginning. The scanner keeps its
+// options and reuses the memory it has already allocated (including the copy
+// of the text unless it was created by ScannerNoCopy). As the copy is reused
+// the Lexemes of tokens produced before the Reset must not be used after it.
+// If the scanner was created WithFileSet the new text replaces the old one in
+// the FileSet: the file is reused if the text has the same length, otherwise
+// it is removed (with Go 1.20 or later) and the new text is registered as a
+// new file with the same name. So the FileSet does not grow with every Reset.
+// A text longer than the MaxBytes limit (see WithLimits) is not copied, Next
+// returns the *LimitError.
+func (s *Scanner) Reset(text []byte) {
+	if s.copyText && !s.tooLong(text) {
+		// prevent the user from modifying the text under scan
+		s.Text = append(s.Text[:0], text...)
+	} else {
+		s.Text = text
+	}
+	s.TC = 0
+	s.pTC = 0
+	s.sLine, s.sColumn, s.eLine, s.eColumn = 0, 0, 0, 0
+	s.atEOF = false
+	s.tokens = 0
+	s.deferred = nil
+	if s.fset != nil {
+		if s.file == nil || s.file.Size() != len(s.Text) {
+			if s.file != nil {
+				removeFile(s.fset, s.file)
+			}
+			s.file = s.fset.AddFile(s.filename, -1, len(s.Text))
+		}
+		s.file.SetLinesForContent(s.Text)
+	}
+	s.start()
+}
+
+// start a new lexing engine on the text
+func (s *Scanner) start() {
+	s.config.Shortest = s.lexer.shortest
+	s.scan = s.engine(s.Text, &s.config)
+}
+
+// engine creates a lexing engine for text with config.
+func (s *Scanner) engine(text []byte, config *machines.Config) machines.Scanner {
+	l := s.lexer
+	if l.dfa != nil {
+		return machines.DFALexerEngineWithConfig(l.dfa.Start, l.dfa.Error, l.dfa.Trans, l.dfa.Accepting, text, config)
+	}
+	return machines.LexerEngineWithConfig(l.program, text, config)
+}
+
+// fork creates a new scanner over the same text (and file) with the same
+// options at the beginning of the text. It shares the line endings indexed by
+// s. The OnEOF action is not run by the new scanner.
+func (s *Scanner) fork() *Scanner {
+	f := &Scanner{
+		lexer:    s.lexer,
+		matches:  s.matches,
+		config:   s.config,
+		copyText: s.copyText,
+		fset:     s.fset,
+		filename: s.filename,
+		file:     s.file,
+		explain:  s.explain,
+		atEOF:    true,
+		ctx:      s.ctx,
+		limits:   s.limits,
+		Text:     s.Text,
+	}
+	f.config.Buffers = s.config.Buffers.Fork()
+	if f.explain != nil {
+		f.config.Trace = f.trace
+	}
+	if f.config.Interrupt != nil {
+		f.config.Interrupt = f.interrupt
+	}
+	f.start()
+	return f
+}
+
 // Add pattern to match on. When a match occurs during scanning the action
 // function will be called by the Scanner to turn the low level machines.Match
 // struct into a token.
 func (l *Lexer) Add(regex []byte, action Action) {
-	if l.program != nil {
-		l.program = nil
-	}
-	l.patterns = append(l.patterns, &pattern{regex, action})
+	l.add(&pattern{regex: regex, action: action})
+}
+
+// AddShortest adds a pattern which matches the shortest lexeme rather than
+// the longest. The Scanner stops as soon as the pattern matches (if it has
+// priority over the other patterns matching there) instead of looking for a
+// longer match. This makes delimited tokens easy to write, a block comment is
+// just:
+//
+//     lexer.AddShortest([]byte(`/\*.*\*/`), skip)
+//
+// Note the pattern stops the Scanner even when a different pattern could
+// match a longer lexeme.
+func (l *Lexer) AddShortest(regex []byte, action Action) {
+	l.add(&pattern{regex: regex, action: action, shortest: true})
+}
+
+// AddSetOps adds a pattern which may use the set operators: & (intersection),
+// -- (difference) and ~ (complement). For instance an identifier which is not
+// a keyword is:
+//
+//     lexer.AddSetOps([]byte(`[a-z]+--(if|else)`), token("ID"))
+//
+// In these patterns &, ~ and -- must be escaped (\&, \~ and \-\-) to match
+// the characters. The patterns added with Add match them literally. A lexer
+// with set operators is always compiled through a DFA, CompileNFA runs a
+// program translated from the DFA.
+func (l *Lexer) AddSetOps(regex []byte, action Action) {
+	l.add(&pattern{regex: regex, action: action, setOps: true})
+}
+
+// OnEOF sets an action which is run once when the Scanner reaches the end of
+// the text. It is called with an empty match at the end of the text (its TC is
+// len(scan.Text) and its lines and columns are the position just past the
+// last byte) and, like any other Action, may return a final token (such as an
+// EOF or DEDENT token), an error (such as an unclosed block) or neither. Next
+// reports the end of the text after it. For example:
+//
+//     lexer.OnEOF(func(scan *lexmachine.Scanner, match *machines.Match) (interface{}, error) {
+//         return scan.Token(tokens["EOF"], nil, match), nil
+//     })
+//
+func (l *Lexer) OnEOF(action Action) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.eof = action
+	l.compiled = nil
+}
+
+func (l *Lexer) add(p *pattern) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.program = nil
+	l.nfaMatches = nil
+	l.dfa = nil
+	l.dfaMatches = nil
+	l.compiled = nil
+	l.patterns = append(l.patterns, p)
 }
 
 // Compile the supplied patterns to an DFA (default). You don't need to call
@@ -239,10 +777,29 @@ func (l *Lexer) Compile() error {
 	return l.CompileDFA()
 }
 
+// AST returns the patterns parsed and joined into the single AST the lexer
+// compiles. It has a MATCH for each pattern in the order the patterns were
+// added. It is useful to tools which inspect the automata (see the dfa
+// package) of a lexer.
+func (l *Lexer) AST() (frontend.AST, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.patterns) == 0 {
+		return nil, fmt.Errorf("No patterns added")
+	}
+	return l.assembleAST()
+}
+
 func (l *Lexer) assembleAST() (frontend.AST, error) {
-	asts := make([]frontend.AST, 0, len(l.patterns))
-	for _, p := range l.patterns {
-		ast, err := frontend.Parse(p.regex)
+	return assembleAST(l.patterns)
+}
+
+// assembleAST parses the patterns and joins them into a single AST with a
+// match for each pattern.
+func assembleAST(patterns []*pattern) (frontend.AST, error) {
+	asts := make([]frontend.AST, 0, len(patterns))
+	for _, p := range patterns {
+		ast, err := p.parse()
 		if err != nil {
 			return nil, err
 		}
@@ -258,6 +815,12 @@ func (l *Lexer) assembleAST() (frontend.AST, error) {
 // CompileNFA compiles an NFA explicitly. If no DFA has been created (which is
 // only created explicitly) this will be used by Scanners when they are created.
 func (l *Lexer) CompileNFA() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.compileNFA()
+}
+
+func (l *Lexer) compileNFA() error {
 	if len(l.patterns) == 0 {
 		return fmt.Errorf("No patterns added")
 	}
@@ -268,13 +831,22 @@ func (l *Lexer) CompileNFA() error {
 	if err != nil {
 		return err
 	}
-	program, err := frontend.Generate(lexast)
-	if err != nil {
+	var program inst.Slice
+	if frontend.HasSetOps(lexast) {
+		// set operators can only be compiled to a DFA so the NFA engine
+		// runs the DFA translated back into byte code
+		dfa, err := dfapkg.Generate(lexast)
+		if err != nil {
+			return err
+		}
+		program = dfa.Program()
+	} else if program, err = frontend.Generate(lexast); err != nil {
 		return err
 	}
 
 	l.program = program
 	l.nfaMatches = make(map[int]int)
+	l.compiled = nil
 
 	ast := 0
 	for i, instruction := range l.program {
@@ -298,6 +870,12 @@ func (l *Lexer) CompileNFA() error {
 // CompileDFA compiles an DFA explicitly. This will be used by Scanners when
 // they are created.
 func (l *Lexer) CompileDFA() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.compileDFA()
+}
+
+func (l *Lexer) compileDFA() error {
 	if len(l.patterns) == 0 {
 		return fmt.Errorf("No patterns added")
 	}
@@ -308,9 +886,13 @@ func (l *Lexer) CompileDFA() error {
 	if err != nil {
 		return err
 	}
-	dfa := dfapkg.Generate(lexast)
+	dfa, err := dfapkg.Generate(lexast)
+	if err != nil {
+		return err
+	}
 	l.dfa = dfa
 	l.dfaMatches = make(map[int]int)
+	l.compiled = nil
 	for mid := range dfa.Matches {
 		l.dfaMatches[mid] = mid
 	}
@@ -325,10 +907,11 @@ func (l *Lexer) CompileDFA() error {
 }
 
 func (l *Lexer) matchesEmptyString() (bool, error) {
-	s, err := l.Scanner([]byte(""))
+	s, err := l.snapshot().Scanner([]byte(""))
 	if err != nil {
 		return false, err
 	}
+	s.atEOF = true
 	_, err, _ = s.Next()
 	if ese, is := err.(*machines.EmptyMatchError); ese != nil && is {
 		return true, nil
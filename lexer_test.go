@@ -1,9 +1,15 @@
 package lexmachine
 
 import (
+	"bytes"
 	"fmt"
+	gotoken "go/token"
+	"math/rand"
+	"reflect"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/timtadh/data-structures/test"
@@ -95,21 +101,21 @@ func TestSimple(x *testing.T) {
 	`)
 
 	expected := []*Token{
-		{NAME, "name", []byte("name"), 3, 2, 3, 2, 6},
-		{EQUALS, nil, []byte("="), 8, 2, 8, 2, 8},
-		{NUMBER, 10, []byte("10"), 10, 2, 10, 2, 11},
-		{PRINT, nil, []byte("print"), 15, 3, 3, 3, 7},
-		{NAME, "name", []byte("name"), 21, 3, 9, 3, 12},
-		{PRINT, nil, []byte("print"), 28, 4, 3, 4, 7},
-		{NAME, "fred", []byte("fred"), 34, 4, 9, 4, 12},
-		{NAME, "name", []byte("name"), 41, 5, 3, 5, 6},
-		{EQUALS, nil, []byte("="), 46, 5, 8, 5, 8},
-		{NUMBER, 12, []byte("12"), 47, 5, 9, 5, 10},
-		{NAME, "printname", []byte("printname"), 112, 9, 11, 9, 19},
-		{EQUALS, nil, []byte("="), 122, 9, 21, 9, 21},
-		{NUMBER, 13, []byte("13"), 124, 9, 23, 9, 24},
-		{PRINT, nil, []byte("print"), 129, 10, 3, 10, 7},
-		{NAME, "printname", []byte("printname"), 135, 10, 9, 10, 17},
+		{Type: NAME, Value: "name", Lexeme: []byte("name"), TC: 3, StartLine: 2, StartColumn: 3, EndLine: 2, EndColumn: 6},
+		{Type: EQUALS, Value: nil, Lexeme: []byte("="), TC: 8, StartLine: 2, StartColumn: 8, EndLine: 2, EndColumn: 8},
+		{Type: NUMBER, Value: 10, Lexeme: []byte("10"), TC: 10, StartLine: 2, StartColumn: 10, EndLine: 2, EndColumn: 11},
+		{Type: PRINT, Value: nil, Lexeme: []byte("print"), TC: 15, StartLine: 3, StartColumn: 3, EndLine: 3, EndColumn: 7},
+		{Type: NAME, Value: "name", Lexeme: []byte("name"), TC: 21, StartLine: 3, StartColumn: 9, EndLine: 3, EndColumn: 12},
+		{Type: PRINT, Value: nil, Lexeme: []byte("print"), TC: 28, StartLine: 4, StartColumn: 3, EndLine: 4, EndColumn: 7},
+		{Type: NAME, Value: "fred", Lexeme: []byte("fred"), TC: 34, StartLine: 4, StartColumn: 9, EndLine: 4, EndColumn: 12},
+		{Type: NAME, Value: "name", Lexeme: []byte("name"), TC: 41, StartLine: 5, StartColumn: 3, EndLine: 5, EndColumn: 6},
+		{Type: EQUALS, Value: nil, Lexeme: []byte("="), TC: 46, StartLine: 5, StartColumn: 8, EndLine: 5, EndColumn: 8},
+		{Type: NUMBER, Value: 12, Lexeme: []byte("12"), TC: 47, StartLine: 5, StartColumn: 9, EndLine: 5, EndColumn: 10},
+		{Type: NAME, Value: "printname", Lexeme: []byte("printname"), TC: 112, StartLine: 9, StartColumn: 11, EndLine: 9, EndColumn: 19},
+		{Type: EQUALS, Value: nil, Lexeme: []byte("="), TC: 122, StartLine: 9, StartColumn: 21, EndLine: 9, EndColumn: 21},
+		{Type: NUMBER, Value: 13, Lexeme: []byte("13"), TC: 124, StartLine: 9, StartColumn: 23, EndLine: 9, EndColumn: 24},
+		{Type: PRINT, Value: nil, Lexeme: []byte("print"), TC: 129, StartLine: 10, StartColumn: 3, EndLine: 10, EndColumn: 7},
+		{Type: NAME, Value: "printname", Lexeme: []byte("printname"), TC: 135, StartLine: 10, StartColumn: 9, EndLine: 10, EndColumn: 17},
 	}
 
 	scan := func(lexer *Lexer) {
@@ -536,3 +542,802 @@ func TestNoEmptyStrings(t *testing.T) {
 		}
 	}
 }
+
+func TestFileSet(x *testing.T) {
+	t := (*test.T)(x)
+	token := func(s *Scanner, m *machines.Match) (interface{}, error) {
+		return s.Token(0, string(m.Bytes), m), nil
+	}
+	lexer := NewLexer()
+	lexer.Add([]byte(`[a-z]+`), token)
+	lexer.Add([]byte(`( |\n)+`), func(*Scanner, *machines.Match) (interface{}, error) {
+		return nil, nil
+	})
+	t.AssertNil(lexer.Compile())
+
+	fset := gotoken.NewFileSet()
+	fset.AddFile("other.txt", -1, 100)
+	scanner, err := lexer.Scanner([]byte("ab cd\n  ef $"), WithFileSet(fset, "test.txt"))
+	t.AssertNil(err)
+	t.Assert(scanner.File() != nil, "expected a file")
+
+	expected := []string{"test.txt:1:1", "test.txt:1:4", "test.txt:2:3"}
+	i := 0
+	for tok, err, eos := scanner.Next(); !eos; tok, err, eos = scanner.Next() {
+		if ui, is := err.(*machines.UnconsumedInput); is {
+			p := fset.Position(ui.StartPos)
+			t.Assert(p.String() == "test.txt:2:6", "got %v", p)
+			t.Assert(p.Line == ui.StartLine && p.Column == ui.StartColumn, "got %v for %v", p, ui)
+			break
+		}
+		t.AssertNil(err)
+		tk := tok.(*Token)
+		p := fset.Position(tk.Pos)
+		t.Assert(p.String() == expected[i], "expected %v got %v", expected[i], p)
+		t.Assert(p.Line == tk.StartLine && p.Column == tk.StartColumn, "got %v for %v", p, tk)
+		i++
+	}
+	t.Assert(i == len(expected), "expected %d tokens got %d", len(expected), i)
+}
+
+func TestPositionOptions(x *testing.T) {
+	t := (*test.T)(x)
+	text := []byte("a\tb\r\nxé\U0001F600 c\rd")
+	newLexer := func() *Lexer {
+		lexer := NewLexer()
+		lexer.Add([]byte(`[^ \t\r\n]+`), func(s *Scanner, m *machines.Match) (interface{}, error) {
+			return s.Token(0, string(m.Bytes), m), nil
+		})
+		lexer.Add([]byte(`[ \t\r\n]+`), func(*Scanner, *machines.Match) (interface{}, error) {
+			return nil, nil
+		})
+		return lexer
+	}
+	type pos struct{ sl, sc, el, ec int }
+	tests := []struct {
+		options  []ScannerOption
+		expected []pos
+	}{
+		{nil, []pos{{1, 1, 1, 1}, {1, 3, 1, 3}, {2, 1, 2, 7}, {2, 9, 2, 9}, {2, 11, 2, 11}}},
+		{
+			[]ScannerOption{WithColumns(machines.UTF16Columns), WithTabWidth(4), WithNewlines(machines.CR)},
+			[]pos{{1, 1, 1, 1}, {1, 5, 1, 5}, {2, 1, 2, 3}, {2, 6, 2, 6}, {3, 1, 3, 1}},
+		},
+		{
+			[]ScannerOption{WithColumns(machines.RuneColumns), WithNewlines(machines.CRLF)},
+			[]pos{{1, 1, 1, 1}, {1, 3, 1, 3}, {2, 1, 2, 3}, {2, 5, 2, 5}, {2, 7, 2, 7}},
+		},
+	}
+	runTest := func(lexer *Lexer) {
+		for _, test := range tests {
+			scanner, err := lexer.Scanner(text, test.options...)
+			t.AssertNil(err)
+			i := 0
+			for tok, err, eos := scanner.Next(); !eos; tok, err, eos = scanner.Next() {
+				t.AssertNil(err)
+				tk := tok.(*Token)
+				e := test.expected[i]
+				t.Assert(tk.StartLine == e.sl && tk.StartColumn == e.sc && tk.EndLine == e.el && tk.EndColumn == e.ec,
+					"expected %v got %v", e, tk)
+				i++
+			}
+			t.Assert(i == len(test.expected), "expected %d tokens got %d", len(test.expected), i)
+		}
+	}
+	{
+		lexer := newLexer()
+		t.AssertNil(lexer.CompileNFA())
+		runTest(lexer)
+	}
+	{
+		lexer := newLexer()
+		t.AssertNil(lexer.CompileDFA())
+		runTest(lexer)
+	}
+}
+
+func benchmarkScan(b *testing.B, compile func(*Lexer) error) {
+	lexer := NewLexer()
+	lexer.Add([]byte(`[a-z]+`), func(*Scanner, *machines.Match) (interface{}, error) {
+		return true, nil
+	})
+	lexer.Add([]byte(`[0-9]+`), func(*Scanner, *machines.Match) (interface{}, error) {
+		return true, nil
+	})
+	lexer.Add([]byte(`( |\n)+`), func(*Scanner, *machines.Match) (interface{}, error) {
+		return nil, nil
+	})
+	if err := compile(lexer); err != nil {
+		b.Fatal(err)
+	}
+	line := []byte("the quick brown fox jumped over 1234 lazy dogs and 56 cats\n")
+	text := bytes.Repeat(line, 1<<14)
+	b.SetBytes(int64(len(text)))
+	b.ReportAllocs()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		scanner, err := lexer.Scanner(text)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, err, eos := scanner.Next(); !eos; _, err, eos = scanner.Next() {
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	b.StopTimer()
+	runtime.ReadMemStats(&after)
+	b.ReportMetric(float64(after.TotalAlloc-before.TotalAlloc)/float64(b.N*len(text)), "B/input-byte")
+}
+
+func BenchmarkScanDFA(b *testing.B) {
+	benchmarkScan(b, (*Lexer).CompileDFA)
+}
+
+func BenchmarkScanNFA(b *testing.B) {
+	benchmarkScan(b, (*Lexer).CompileNFA)
+}
+
+func TestScannerReset(x *testing.T) {
+	t := (*test.T)(x)
+	texts := []string{"ab 12\ncd", "x", "", "1 2 3 four\n\n five"}
+	newLexer := func() *Lexer {
+		lexer := NewLexer()
+		lexer.Add([]byte(`[a-z]+`), func(s *Scanner, m *machines.Match) (interface{}, error) {
+			return s.Token(0, string(m.Bytes), m), nil
+		})
+		lexer.Add([]byte(`[0-9]+`), func(s *Scanner, m *machines.Match) (interface{}, error) {
+			return s.Token(1, string(m.Bytes), m), nil
+		})
+		lexer.Add([]byte(`( |\n)+`), func(*Scanner, *machines.Match) (interface{}, error) {
+			return nil, nil
+		})
+		return lexer
+	}
+	collect := func(scanner *Scanner) []*Token {
+		toks := make([]*Token, 0, 10)
+		for tok, err, eos := scanner.Next(); !eos; tok, err, eos = scanner.Next() {
+			t.AssertNil(err)
+			toks = append(toks, tok.(*Token))
+		}
+		return toks
+	}
+	runTest := func(lexer *Lexer) {
+		copying, err := lexer.Scanner(nil)
+		t.AssertNil(err)
+		noCopy, err := lexer.ScannerNoCopy(nil)
+		t.AssertNil(err)
+		for _, text := range texts {
+			fresh, err := lexer.Scanner([]byte(text))
+			t.AssertNil(err)
+			expected := collect(fresh)
+			buf := []byte(text)
+			copying.Reset(buf)
+			noCopy.Reset(buf)
+			if len(buf) > 0 {
+				t.Assert(&noCopy.Text[0] == &buf[0], "ScannerNoCopy should not copy the text")
+				t.Assert(&copying.Text[0] != &buf[0], "Scanner should copy the text")
+			}
+			for _, scanner := range []*Scanner{copying, noCopy} {
+				toks := collect(scanner)
+				t.Assert(len(toks) == len(expected), "expected %v got %v", expected, toks)
+				for i := range toks {
+					t.Assert(toks[i].Equals(expected[i]), "expected %v got %v", expected[i], toks[i])
+				}
+			}
+		}
+	}
+	{
+		lexer := newLexer()
+		t.AssertNil(lexer.CompileNFA())
+		runTest(lexer)
+	}
+	{
+		lexer := newLexer()
+		t.AssertNil(lexer.CompileDFA())
+		runTest(lexer)
+	}
+
+	// Reset and Edit replace the file of the text in the FileSet
+	countFiles := func(fset *gotoken.FileSet) int {
+		n := 0
+		fset.Iterate(func(*gotoken.File) bool {
+			n++
+			return true
+		})
+		return n
+	}
+	fset := gotoken.NewFileSet()
+	scanner, err := newLexer().Scanner(nil, WithFileSet(fset, "reset"))
+	t.AssertNil(err)
+	for _, text := range append(texts, texts...) {
+		scanner.Reset([]byte(text))
+		toks := collect(scanner)
+		if len(toks) > 0 {
+			position := fset.Position(toks[0].Pos)
+			t.Assert(position.Line == toks[0].StartLine, "expected line %d got %v", toks[0].StartLine, position)
+		}
+	}
+	ts, err := newLexer().TokenStream([]byte("ab 12"), WithFileSet(fset, "edit"))
+	t.AssertNil(err)
+	for i := 0; i < 10; i++ {
+		_, err := ts.Edit(0, 0, []byte("x\n"))
+		t.AssertNil(err)
+	}
+	if canRemoveFiles {
+		t.Assert(countFiles(fset) == 2, "expected 2 files got %d", countFiles(fset))
+	}
+}
+
+func BenchmarkScanSmallMessages(b *testing.B) {
+	lexer := NewLexer()
+	lexer.Add([]byte(`[a-z]+|[0-9]+`), func(*Scanner, *machines.Match) (interface{}, error) {
+		return true, nil
+	})
+	lexer.Add([]byte(` +`), func(*Scanner, *machines.Match) (interface{}, error) {
+		return nil, nil
+	})
+	if err := lexer.Compile(); err != nil {
+		b.Fatal(err)
+	}
+	msg := []byte("get key 1234")
+	scanAll := func(scanner *Scanner) {
+		for _, err, eos := scanner.Next(); !eos; _, err, eos = scanner.Next() {
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	b.Run("Scanner", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			scanner, err := lexer.Scanner(msg)
+			if err != nil {
+				b.Fatal(err)
+			}
+			scanAll(scanner)
+		}
+	})
+	b.Run("ScannerNoCopy+Reset", func(b *testing.B) {
+		b.ReportAllocs()
+		scanner, err := lexer.ScannerNoCopy(msg)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for i := 0; i < b.N; i++ {
+			scanner.Reset(msg)
+			scanAll(scanner)
+		}
+	})
+}
+
+func TestConcurrentScanners(x *testing.T) {
+	t := (*test.T)(x)
+	text := []byte("the quick brown fox 12 jumped\nover 34 lazy dogs\n")
+	newLexer := func() *Lexer {
+		lexer := NewLexer()
+		lexer.Add([]byte(`[a-z]+`), func(s *Scanner, m *machines.Match) (interface{}, error) {
+			return s.Token(0, string(m.Bytes), m), nil
+		})
+		lexer.Add([]byte(`[0-9]+`), func(s *Scanner, m *machines.Match) (interface{}, error) {
+			return s.Token(1, string(m.Bytes), m), nil
+		})
+		lexer.Add([]byte(`( |\n)+`), func(*Scanner, *machines.Match) (interface{}, error) {
+			return nil, nil
+		})
+		return lexer
+	}
+	scanAll := func(newScanner func([]byte, ...ScannerOption) (*Scanner, error)) error {
+		scanner, err := newScanner(text)
+		if err != nil {
+			return err
+		}
+		count := 0
+		for _, err, eos := scanner.Next(); !eos; _, err, eos = scanner.Next() {
+			if err != nil {
+				return err
+			}
+			count++
+		}
+		if count != 10 {
+			return fmt.Errorf("expected 10 tokens got %d", count)
+		}
+		return nil
+	}
+	run := func(newScanner func([]byte, ...ScannerOption) (*Scanner, error)) {
+		var wg sync.WaitGroup
+		errs := make(chan error, 32)
+		for i := 0; i < cap(errs); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 10; j++ {
+					if err := scanAll(newScanner); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Error(err)
+		}
+	}
+
+	// a Lexer which is compiled lazily by the first Scanner call
+	run(newLexer().Scanner)
+
+	// a lexer which is modified while scanners are being created
+	lexer := newLexer()
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			lexer.Add([]byte(fmt.Sprintf("kw%d", i)), func(s *Scanner, m *machines.Match) (interface{}, error) {
+				return s.Token(2, string(m.Bytes), m), nil
+			})
+		}
+	}()
+	run(lexer.Scanner)
+	<-done
+
+	// CompiledLexers from both backends
+	for _, compile := range []func(*Lexer) error{(*Lexer).CompileDFA, (*Lexer).CompileNFA} {
+		lexer := newLexer()
+		t.AssertNil(compile(lexer))
+		compiled, err := lexer.Compiled()
+		t.AssertNil(err)
+		lexer.Add([]byte("fox"), func(*Scanner, *machines.Match) (interface{}, error) {
+			return nil, nil
+		})
+		run(compiled.Scanner)
+		run(compiled.ScannerNoCopy)
+	}
+}
+
+func TestScanParallel(x *testing.T) {
+	t := (*test.T)(x)
+	newLexer := func() *Lexer {
+		token := func(typ int) Action {
+			return func(s *Scanner, m *machines.Match) (interface{}, error) {
+				return s.Token(typ, string(m.Bytes), m), nil
+			}
+		}
+		lexer := NewLexer()
+		lexer.Add([]byte(`[a-z]+`), token(0))
+		lexer.Add([]byte(`[0-9]+`), token(1))
+		lexer.Add([]byte(`"[^"]*"`), token(2))
+		lexer.Add([]byte(`/\*([^*]|\*+[^*/])*\*+/`), token(3))
+		lexer.Add([]byte(`( |\t|\n)+`), func(*Scanner, *machines.Match) (interface{}, error) {
+			return nil, nil
+		})
+		return lexer
+	}
+	sequential := func(lexer *Lexer, text []byte) ([]*Token, error) {
+		scanner, err := lexer.Scanner(text)
+		t.AssertNil(err)
+		toks := make([]*Token, 0, 10)
+		for tok, err, eos := scanner.Next(); !eos; tok, err, eos = scanner.Next() {
+			if err != nil {
+				return toks, err
+			}
+			toks = append(toks, tok.(*Token))
+		}
+		return toks, nil
+	}
+	pieces := []string{"abc", " ", "\n", "12", "\"str\ning\"", "/* multi\nline\n */", "x\ny", "\t"}
+	r := rand.New(rand.NewSource(7))
+	runTest := func(lexer *Lexer) {
+		for trial := 0; trial < 100; trial++ {
+			var buf bytes.Buffer
+			n := r.Intn(200)
+			for i := 0; i < n; i++ {
+				buf.WriteString(pieces[r.Intn(len(pieces))])
+			}
+			if trial%10 == 9 {
+				buf.WriteString(" $ abc")
+			}
+			text := buf.Bytes()
+			expected, expectedErr := sequential(lexer, text)
+			var boundaries []int
+			if trial%2 == 1 {
+				// arbitrary (mostly unsafe) boundaries
+				for b := r.Intn(7) + 1; b < len(text); b += r.Intn(13) + 1 {
+					boundaries = append(boundaries, b)
+				}
+			}
+			toks, err := lexer.ScanParallel(text, boundaries, 1+trial%5)
+			t.Assert((err == nil) == (expectedErr == nil), "expected error %v got %v", expectedErr, err)
+			if err != nil {
+				t.Assert(err.Error() == expectedErr.Error(), "expected error %v got %v", expectedErr, err)
+			}
+			t.Assert(len(toks) == len(expected), "expected %d tokens got %d for %q", len(expected), len(toks), text)
+			for i := range toks {
+				t.Assert(toks[i].(*Token).Equals(expected[i]), "expected %v got %v", expected[i], toks[i])
+			}
+		}
+	}
+	{
+		lexer := newLexer()
+		t.AssertNil(lexer.CompileNFA())
+		runTest(lexer)
+	}
+	{
+		lexer := newLexer()
+		t.AssertNil(lexer.CompileDFA())
+		runTest(lexer)
+	}
+}
+
+// BenchmarkScanParallel compares ScanParallel (with GOMAXPROCS workers) to a
+// single Scanner. Run it with -cpu to vary the number of workers.
+func BenchmarkScanParallel(b *testing.B) {
+	lexer := NewLexer()
+	lexer.Add([]byte(`[a-z]+`), func(s *Scanner, m *machines.Match) (interface{}, error) {
+		return s.Token(0, nil, m), nil
+	})
+	lexer.Add([]byte(`[0-9]+`), func(s *Scanner, m *machines.Match) (interface{}, error) {
+		return s.Token(1, nil, m), nil
+	})
+	lexer.Add([]byte(`( |\n)+`), func(*Scanner, *machines.Match) (interface{}, error) {
+		return nil, nil
+	})
+	if err := lexer.Compile(); err != nil {
+		b.Fatal(err)
+	}
+	line := []byte("the quick brown fox jumped over 1234 lazy dogs and 56 cats\n")
+	text := bytes.Repeat(line, 1<<14)
+	b.Run("Scanner", func(b *testing.B) {
+		b.SetBytes(int64(len(text)))
+		for i := 0; i < b.N; i++ {
+			scanner, err := lexer.ScannerNoCopy(text)
+			if err != nil {
+				b.Fatal(err)
+			}
+			// keep the tokens as ScanParallel does
+			toks := make([]interface{}, 0, 10)
+			for tok, err, eos := scanner.Next(); !eos; tok, err, eos = scanner.Next() {
+				if err != nil {
+					b.Fatal(err)
+				}
+				toks = append(toks, tok)
+			}
+		}
+	})
+	for _, chunks := range []int{1, 16, 64} {
+		boundaries := lineBoundaries(text, chunks)
+		b.Run(fmt.Sprintf("ScanParallel/chunks=%d", chunks), func(b *testing.B) {
+			b.SetBytes(int64(len(text)))
+			for i := 0; i < b.N; i++ {
+				if _, err := lexer.ScanParallel(text, boundaries, 0); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestSetOps(x *testing.T) {
+	t := (*test.T)(x)
+	newLexer := func() *Lexer {
+		lexer := NewLexer()
+		lexer.AddSetOps([]byte(`[a-z]+--(if|else)`), func(s *Scanner, m *machines.Match) (interface{}, error) {
+			return s.Token(0, string(m.Bytes), m), nil
+		})
+		lexer.Add([]byte(`if|else`), func(s *Scanner, m *machines.Match) (interface{}, error) {
+			return s.Token(1, string(m.Bytes), m), nil
+		})
+		// a string without an interpolation
+		lexer.AddSetOps([]byte(`"([^"]*--.*\$\{.*)"`), func(s *Scanner, m *machines.Match) (interface{}, error) {
+			return s.Token(2, string(m.Bytes), m), nil
+		})
+		lexer.Add([]byte(`( |\t|\n|\r)+`), func(*Scanner, *machines.Match) (interface{}, error) {
+			return nil, nil
+		})
+		return lexer
+	}
+	text := []byte(`if iff else elsex "a $b" "{$}" x`)
+	expected := []struct {
+		typ    int
+		lexeme string
+	}{
+		{1, "if"}, {0, "iff"}, {1, "else"}, {0, "elsex"}, {2, `"a $b"`}, {2, `"{$}"`}, {0, "x"},
+	}
+	runTest := func(lexer *Lexer) {
+		scanner, err := lexer.Scanner(text)
+		t.AssertNil(err)
+		i := 0
+		for tok, err, eos := scanner.Next(); !eos; tok, err, eos = scanner.Next() {
+			t.AssertNil(err)
+			tk := tok.(*Token)
+			t.Assert(i < len(expected), "unexpected token %v", tk)
+			t.Assert(tk.Type == expected[i].typ && string(tk.Lexeme) == expected[i].lexeme,
+				"expected %v got %v", expected[i], tk)
+			i++
+		}
+		t.Assert(i == len(expected), "expected %d tokens got %d", len(expected), i)
+
+		scanner, err = lexer.Scanner([]byte(`"a ${b}"`))
+		t.AssertNil(err)
+		_, err, _ = scanner.Next()
+		_, is := err.(*machines.UnconsumedInput)
+		t.Assert(is, "expected unconsumed input got %v", err)
+	}
+	{
+		lexer := newLexer()
+		t.AssertNil(lexer.CompileNFA())
+		runTest(lexer)
+	}
+	{
+		lexer := newLexer()
+		t.AssertNil(lexer.CompileDFA())
+		runTest(lexer)
+	}
+	{
+		lexer := NewLexer()
+		lexer.AddSetOps([]byte(`~a`), nil)
+		t.Assert(lexer.CompileNFA() != nil, "expected the empty string to be rejected")
+		t.Assert(lexer.CompileDFA() != nil, "expected the empty string to be rejected")
+	}
+	// the patterns added with Add match &, ~ and -- literally
+	for _, compile := range []func(*Lexer) error{(*Lexer).CompileNFA, (*Lexer).CompileDFA} {
+		lexer := NewLexer()
+		for i, regex := range []string{`--[^\n]*`, `\+\+|--`, `&&|\|\|`, `~`} {
+			typ := i
+			lexer.Add([]byte(regex), func(s *Scanner, m *machines.Match) (interface{}, error) {
+				return s.Token(typ, string(m.Bytes), m), nil
+			})
+		}
+		t.AssertNil(compile(lexer))
+		scanner, err := lexer.Scanner([]byte("&&~||-- x"))
+		t.AssertNil(err)
+		var toks []string
+		for tok, err, eos := scanner.Next(); !eos; tok, err, eos = scanner.Next() {
+			t.AssertNil(err)
+			toks = append(toks, tok.(*Token).Value.(string))
+		}
+		t.Assert(strings.Join(toks, ",") == "&&,~,||,-- x", "got %v", toks)
+	}
+}
+
+func TestShortest(x *testing.T) {
+	t := (*test.T)(x)
+	token := func(typ int) Action {
+		return func(s *Scanner, m *machines.Match) (interface{}, error) {
+			return s.Token(typ, string(m.Bytes), m), nil
+		}
+	}
+	newLexer := func(shortest bool) *Lexer {
+		lexer := NewLexer()
+		if shortest {
+			lexer.AddShortest([]byte(`<!\-\-.*\-\->`), token(0))
+		} else {
+			lexer.Add([]byte(`<!\-\-.*\-\->`), token(0))
+		}
+		lexer.Add([]byte(`<[a-z]+>`), token(1))
+		lexer.Add([]byte(`[a-z]+`), token(2))
+		lexer.Add([]byte(`( |\n)+`), func(*Scanner, *machines.Match) (interface{}, error) {
+			return nil, nil
+		})
+		return lexer
+	}
+	text := []byte("<!-- a --> b <p>\n<!--c-->")
+	scan := func(lexer *Lexer) (lexemes []string) {
+		scanner, err := lexer.Scanner(text)
+		t.AssertNil(err)
+		for tok, err, eos := scanner.Next(); !eos; tok, err, eos = scanner.Next() {
+			t.Assert(err == nil, "unexpected error %v", err)
+			lexemes = append(lexemes, string(tok.(*Token).Lexeme))
+		}
+		return lexemes
+	}
+	for _, compile := range []func(*Lexer) error{(*Lexer).CompileNFA, (*Lexer).CompileDFA} {
+		lexer := newLexer(true)
+		t.AssertNil(compile(lexer))
+		lexemes := scan(lexer)
+		expected := []string{"<!-- a -->", "b", "<p>", "<!--c-->"}
+		t.Assert(reflect.DeepEqual(lexemes, expected), "expected %q got %q", expected, lexemes)
+
+		lexer = newLexer(false)
+		t.AssertNil(compile(lexer))
+		lexemes = scan(lexer)
+		expected = []string{string(text)}
+		t.Assert(reflect.DeepEqual(lexemes, expected), "expected %q got %q", expected, lexemes)
+	}
+}
+
+func TestExtendMatch(x *testing.T) {
+	t := (*test.T)(x)
+	text := []byte("<9 a\r\n\tb c> x: @ zz")
+	newLexer := func() *Lexer {
+		lexer := NewLexer()
+		// a counted literal: <n followed by the next n bytes
+		lexer.Add([]byte(`<[0-9]`), func(s *Scanner, m *machines.Match) (interface{}, error) {
+			n := int(m.Bytes[1] - '0')
+			consumed, err := s.Consume(n)
+			t.AssertNil(err)
+			t.Assert(len(consumed) == n, "expected %d bytes got %q", n, consumed)
+			return s.Token(0, string(m.Bytes), m), nil
+		})
+		// a label without its colon
+		lexer.Add([]byte(`[a-z]+:`), func(s *Scanner, m *machines.Match) (interface{}, error) {
+			t.AssertNil(s.ExtendMatch(m, s.TC-1))
+			return s.Token(1, string(m.Bytes), m), nil
+		})
+		lexer.Add([]byte(`:`), func(s *Scanner, m *machines.Match) (interface{}, error) {
+			return s.Token(2, string(m.Bytes), m), nil
+		})
+		// the rest of the text
+		lexer.Add([]byte(`@`), func(s *Scanner, m *machines.Match) (interface{}, error) {
+			consumed, err := s.Consume(len(s.Text))
+			t.AssertNil(err)
+			t.Assert(string(consumed) == " zz", "got %q", consumed)
+			return s.Token(3, string(m.Bytes), m), nil
+		})
+		lexer.Add([]byte(`( |\t|\r|\n)+`), func(*Scanner, *machines.Match) (interface{}, error) {
+			return nil, nil
+		})
+		return lexer
+	}
+	expected := []*Token{
+		{Type: 0, Lexeme: []byte("<9 a\r\n\tb c>"), TC: 0, StartLine: 1, StartColumn: 1, EndLine: 2, EndColumn: 8},
+		{Type: 1, Lexeme: []byte("x"), TC: 12, StartLine: 2, StartColumn: 10, EndLine: 2, EndColumn: 10},
+		{Type: 2, Lexeme: []byte(":"), TC: 13, StartLine: 2, StartColumn: 11, EndLine: 2, EndColumn: 11},
+		{Type: 3, Lexeme: []byte("@ zz"), TC: 15, StartLine: 2, StartColumn: 13, EndLine: 2, EndColumn: 16},
+	}
+	runTest := func(lexer *Lexer) {
+		scanner, err := lexer.Scanner(text, WithTabWidth(4), WithNewlines(machines.CRLF))
+		t.AssertNil(err)
+		i := 0
+		for tok, err, eos := scanner.Next(); !eos; tok, err, eos = scanner.Next() {
+			t.AssertNil(err)
+			t.Assert(i < len(expected), "unexpected token %v", tok)
+			t.Assert(tok.(*Token).Equals(expected[i]), "expected %v got %v", expected[i], tok)
+			i++
+		}
+		t.Assert(i == len(expected), "expected %d tokens got %d", len(expected), i)
+	}
+	{
+		lexer := newLexer()
+		t.AssertNil(lexer.CompileNFA())
+		runTest(lexer)
+	}
+	{
+		lexer := newLexer()
+		t.AssertNil(lexer.CompileDFA())
+		runTest(lexer)
+	}
+}
+
+func TestExtendMatchErrors(x *testing.T) {
+	t := (*test.T)(x)
+	newLexer := func() *Lexer {
+		lexer := NewLexer()
+		lexer.Add([]byte(`[a-z]+`), func(s *Scanner, m *machines.Match) (interface{}, error) {
+			tc := s.TC
+			t.Assert(s.ExtendMatch(m, m.TC) != nil, "expected an error for an empty match")
+			_, err := s.Consume(-1)
+			t.Assert(err != nil, "expected an error for a negative count")
+			t.Assert(s.TC == tc && len(m.Bytes) == tc-m.TC, "the match was changed to %q", m.Bytes)
+			return s.Token(0, string(m.Bytes), m), nil
+		})
+		return lexer
+	}
+	runTest := func(lexer *Lexer) {
+		scanner, err := lexer.Scanner([]byte("abc"))
+		t.AssertNil(err)
+		_, err = scanner.Consume(1)
+		t.Assert(err != nil, "expected an error outside of an Action")
+		tok, err, eos := scanner.Next()
+		t.AssertNil(err)
+		t.Assert(!eos && string(tok.(*Token).Lexeme) == "abc", "expected abc got %v", tok)
+	}
+	{
+		lexer := newLexer()
+		t.AssertNil(lexer.CompileNFA())
+		runTest(lexer)
+	}
+	{
+		lexer := newLexer()
+		t.AssertNil(lexer.CompileDFA())
+		runTest(lexer)
+	}
+}
+
+func TestOnEOF(x *testing.T) {
+	t := (*test.T)(x)
+	calls := 0
+	var eofErr error
+	newLexer := func() *Lexer {
+		lexer := NewLexer()
+		lexer.Add([]byte(`[a-z]+`), func(s *Scanner, m *machines.Match) (interface{}, error) {
+			return s.Token(0, string(m.Bytes), m), nil
+		})
+		lexer.Add([]byte(`( |\n)+`), func(*Scanner, *machines.Match) (interface{}, error) {
+			return nil, nil
+		})
+		lexer.OnEOF(func(s *Scanner, m *machines.Match) (interface{}, error) {
+			calls++
+			if eofErr != nil {
+				return nil, eofErr
+			}
+			return s.Token(1, nil, m), nil
+		})
+		return lexer
+	}
+	scan := func(scanner *Scanner) (toks []*Token, err error) {
+		for tok, err, eos := scanner.Next(); !eos; tok, err, eos = scanner.Next() {
+			if err != nil {
+				return toks, err
+			}
+			toks = append(toks, tok.(*Token))
+		}
+		return toks, nil
+	}
+	runTest := func(lexer *Lexer) {
+		for _, c := range []struct {
+			text      string
+			tc        int
+			line, col int
+		}{
+			{"ab cd\n", 6, 2, 1},
+			{"ab\ncd", 5, 2, 3},
+			{"", 0, 1, 1},
+		} {
+			calls = 0
+			scanner, err := lexer.Scanner([]byte(c.text))
+			t.AssertNil(err)
+			toks, err := scan(scanner)
+			t.AssertNil(err)
+			t.Assert(len(toks) > 0, "expected an EOF token for %q", c.text)
+			eof := toks[len(toks)-1]
+			expected := &Token{Type: 1, Lexeme: []byte{}, TC: c.tc, StartLine: c.line, StartColumn: c.col, EndLine: c.line, EndColumn: c.col}
+			t.Assert(eof.Equals(expected), "expected %v got %v", expected, eof)
+			_, _, eos := scanner.Next()
+			t.Assert(eos && calls == 1, "expected the action to run once, it ran %d times", calls)
+
+			parallel, err := lexer.ScanParallel([]byte(c.text), []int{1, 3}, 2)
+			t.AssertNil(err)
+			t.Assert(len(parallel) == len(toks), "expected %d tokens got %d", len(toks), len(parallel))
+			t.Assert(parallel[len(parallel)-1].(*Token).Equals(expected), "expected %v got %v", expected, parallel[len(parallel)-1])
+		}
+
+		calls = 0
+		eofErr = fmt.Errorf("unexpected end of input")
+		scanner, err := lexer.Scanner([]byte("ab cd"))
+		t.AssertNil(err)
+		toks, err := scan(scanner)
+		t.Assert(err == eofErr, "expected %v got %v", eofErr, err)
+		t.Assert(len(toks) == 2, "expected 2 tokens got %v", toks)
+		_, err, eos := scanner.Next()
+		t.Assert(err == nil && eos && calls == 1, "expected the end of the text after the error")
+		scanner.Reset([]byte("ab"))
+		_, err = scan(scanner)
+		t.Assert(err == eofErr && calls == 2, "expected Reset to run the action again")
+		eofErr = nil
+
+		ts, err := lexer.TokenStream([]byte("ab cd"))
+		t.AssertNil(err)
+		_, err = ts.Edit(5, 5, []byte("\nef"))
+		t.AssertNil(err)
+		t.AssertNil(ts.Err)
+		t.Assert(len(ts.Tokens) == 4, "expected 4 tokens got %v", ts.Tokens)
+		expected := &Token{Type: 1, Lexeme: []byte{}, TC: 8, StartLine: 2, StartColumn: 3, EndLine: 2, EndColumn: 3}
+		t.Assert(ts.Tokens[3].(*Token).Equals(expected), "expected %v got %v", expected, ts.Tokens[3])
+	}
+	{
+		lexer := newLexer()
+		t.AssertNil(lexer.CompileNFA())
+		runTest(lexer)
+	}
+	{
+		lexer := newLexer()
+		t.AssertNil(lexer.CompileDFA())
+		runTest(lexer)
+	}
+}
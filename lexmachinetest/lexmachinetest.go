@@ -0,0 +1,237 @@
+// Package lexmachinetest provides golden file tests for lexers. Each input file
+// is lexed and the tokens are compared with a .golden file next to it holding
+// the expected tokens in a stable text format:
+//
+//     1:1-1:4 ID "name"
+//     1:6-1:6 EQUALS "="
+//     1:8-1:9 NUMBER "10"
+//     ! 1:11 unmatched "$"
+//
+// The token name is looked up in the names given (usually the Tokens slice of
+// the lexer, indexed by Token.Type). Text the lexer could not match is
+// recorded (and scanning resumes after it). Any other error is recorded and
+// ends the file.
+//
+// Use it in a test:
+//
+//     func TestGolden(t *testing.T) {
+//         lexmachinetest.Run(t, newLexer(), Tokens, "testdata/*.input")
+//     }
+//
+// Run the tests with -update to (re)write the golden files:
+//
+//     go test -run TestGolden -update
+//
+// The package registers the -update flag so a package importing it must not
+// define a flag with the same name.
+package lexmachinetest
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/timtadh/lexmachine"
+	"github.com/timtadh/lexmachine/machines"
+)
+
+var update = flag.Bool("update", false, "update the .golden files of lexmachinetest.Run")
+
+// Run lexes every file matching the glob pattern with lexer and compares the
+// tokens with the file's golden file (the file name with .golden appended).
+// Each file is a subtest of t. With the -update flag the golden files are
+// written instead.
+func Run(t *testing.T, lexer *lexmachine.Lexer, names []string, pattern string) {
+	t.Helper()
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(paths) == 0 {
+		t.Fatalf("no files match %q", pattern)
+	}
+	for _, path := range paths {
+		path := path
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			text, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Tokens(lexer, names, text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			Compare(t, got, path+".golden")
+		})
+	}
+}
+
+// Compare compares got with the contents of the golden file, reporting the
+// differences to t. With the -update flag got is written to the golden file
+// instead.
+func Compare(t testing.TB, got []byte, golden string) {
+	t.Helper()
+	if *update {
+		if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%v (run the test with -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("the tokens differ from %s (- expected, + got):\n%s", golden, Diff(want, got))
+	}
+}
+
+// Tokens lexes text and formats the tokens in the golden file format. The
+// lexer's Actions must return *lexmachine.Token values (or nil for skipped
+// text).
+func Tokens(lexer *lexmachine.Lexer, names []string, text []byte) ([]byte, error) {
+	scanner, err := lexer.Scanner(text)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	for tok, err, eos := scanner.Next(); !eos; tok, err, eos = scanner.Next() {
+		if ui, is := err.(*machines.UnconsumedInput); is {
+			end := ui.FailTC
+			if end <= ui.StartTC {
+				end = ui.StartTC + 1
+			}
+			fmt.Fprintf(&buf, "! %d:%d unmatched %s\n",
+				ui.StartLine, ui.StartColumn, strconv.Quote(string(text[ui.StartTC:end])))
+			scanner.TC = end
+			continue
+		} else if err != nil {
+			fmt.Fprintf(&buf, "! error %s\n", strconv.Quote(err.Error()))
+			break
+		}
+		t, is := tok.(*lexmachine.Token)
+		if !is {
+			return nil, fmt.Errorf("expected a *lexmachine.Token got %T", tok)
+		}
+		name := strconv.Itoa(t.Type)
+		if 0 <= t.Type && t.Type < len(names) {
+			name = names[t.Type]
+		}
+		fmt.Fprintf(&buf, "%d:%d-%d:%d %s %s\n",
+			t.StartLine, t.StartColumn, t.EndLine, t.EndColumn, name, strconv.Quote(string(t.Lexeme)))
+	}
+	return buf.Bytes(), nil
+}
+
+// maxDiffCells bounds the size of the table Diff uses to line up the lines
+// which changed (the number of removed lines times the number of added lines).
+const maxDiffCells = 1 << 20
+
+// diffLine is a line of a Diff. op is '-', '+' or ' ' (unchanged).
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// Diff returns a line diff of want and got. Removed lines start with "- ",
+// added lines with "+ " and unchanged lines with "  ". Only the unchanged
+// lines near a change are included. The lines between the first and the last
+// change are lined up with a longest common subsequence unless there are too
+// many of them, then they are all shown as removed and then added.
+func Diff(want, got []byte) string {
+	const context = 2
+	a := strings.SplitAfter(string(want), "\n")
+	b := strings.SplitAfter(string(got), "\n")
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	lines := make([]diffLine, 0, len(a)+len(b))
+	for _, l := range a[:prefix] {
+		lines = append(lines, diffLine{' ', l})
+	}
+	lines = diffLines(lines, a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])
+	for _, l := range a[len(a)-suffix:] {
+		lines = append(lines, diffLine{' ', l})
+	}
+	var buf bytes.Buffer
+	skipped := false
+	for k, l := range lines {
+		if l.text == "" {
+			// the empty string after the last newline
+			continue
+		}
+		near := false
+		for x := k - context; x <= k+context; x++ {
+			if 0 <= x && x < len(lines) && lines[x].op != ' ' {
+				near = true
+				break
+			}
+		}
+		if !near {
+			if !skipped {
+				buf.WriteString("  ...\n")
+				skipped = true
+			}
+			continue
+		}
+		skipped = false
+		buf.WriteByte(l.op)
+		buf.WriteByte(' ')
+		buf.WriteString(strings.TrimSuffix(l.text, "\n"))
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
+
+// diffLines appends the diff of a and b to lines.
+func diffLines(lines []diffLine, a, b []string) []diffLine {
+	if (len(a)+1)*(len(b)+1) > maxDiffCells {
+		for _, l := range a {
+			lines = append(lines, diffLine{'-', l})
+		}
+		for _, l := range b {
+			lines = append(lines, diffLine{'+', l})
+		}
+		return lines
+	}
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		if i < len(a) && j < len(b) && a[i] == b[j] {
+			lines = append(lines, diffLine{' ', a[i]})
+			i++
+			j++
+		} else if j >= len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]) {
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		} else {
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		}
+	}
+	return lines
+}
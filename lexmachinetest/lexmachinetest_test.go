@@ -0,0 +1,87 @@
+package lexmachinetest
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/timtadh/data-structures/test"
+	"github.com/timtadh/lexmachine"
+	"github.com/timtadh/lexmachine/machines"
+)
+
+var tokens = []string{"PRINT", "ID", "EQUALS", "NUMBER", "STRING"}
+
+func newLexer() *lexmachine.Lexer {
+	token := func(typ int) lexmachine.Action {
+		return func(s *lexmachine.Scanner, m *machines.Match) (interface{}, error) {
+			return s.Token(typ, string(m.Bytes), m), nil
+		}
+	}
+	lexer := lexmachine.NewLexer()
+	lexer.Add([]byte(`print`), token(0))
+	lexer.Add([]byte(`[a-z]+`), token(1))
+	lexer.Add([]byte(`=`), token(2))
+	lexer.Add([]byte(`[0-9]+`), token(3))
+	lexer.Add([]byte(`"[^"\n]*"`), token(4))
+	lexer.Add([]byte(`"`), func(s *lexmachine.Scanner, m *machines.Match) (interface{}, error) {
+		return nil, fmt.Errorf("unclosed string at %d:%d", m.StartLine, m.StartColumn)
+	})
+	lexer.Add([]byte(`( |\n)+`), func(*lexmachine.Scanner, *machines.Match) (interface{}, error) {
+		return nil, nil
+	})
+	return lexer
+}
+
+func TestRun(t *testing.T) {
+	Run(t, newLexer(), tokens, "testdata/*.input")
+}
+
+func TestTokens(x *testing.T) {
+	t := (*test.T)(x)
+	got, err := Tokens(newLexer(), tokens[:2], []byte("a = 1"))
+	t.AssertNil(err)
+	expected := "1:1-1:1 ID \"a\"\n1:3-1:3 2 \"=\"\n1:5-1:5 3 \"1\"\n"
+	t.Assert(string(got) == expected, "expected %q got %q", expected, got)
+}
+
+func TestDiff(x *testing.T) {
+	t := (*test.T)(x)
+	want := "a\nb\nc\nd\ne\nf\ng\nh\n"
+	got := "a\nb\nc\nd\nE\nf\ng\nh\ni\n"
+	expected := "  ...\n  c\n  d\n- e\n+ E\n  f\n  g\n  h\n+ i\n"
+	diff := Diff([]byte(want), []byte(got))
+	t.Assert(diff == expected, "expected\n%s\ngot\n%s", expected, diff)
+	t.Assert(Diff([]byte(want), []byte(want)) == "  ...\n", "got %q", Diff([]byte(want), []byte(want)))
+}
+
+func TestDiffLarge(x *testing.T) {
+	t := (*test.T)(x)
+	lines := func(n int, format string, changed map[int]string) []byte {
+		var buf bytes.Buffer
+		for i := 0; i < n; i++ {
+			if line, has := changed[i]; has {
+				buf.WriteString(line)
+			} else {
+				fmt.Fprintf(&buf, format, i)
+			}
+			buf.WriteByte('\n')
+		}
+		return buf.Bytes()
+	}
+	// a single change in a long file only compares the changed lines
+	want := lines(200000, "%d", nil)
+	got := lines(200000, "%d", map[int]string{100000: "x"})
+	expected := "  ...\n  99998\n  99999\n- 100000\n+ x\n  100001\n  100002\n  ...\n"
+	diff := Diff(want, got)
+	t.Assert(diff == expected, "expected\n%s\ngot\n%s", expected, diff)
+
+	// too many changed lines to line up
+	n := 2000
+	diff = Diff(lines(n, "a%d", nil), lines(n, "b%d", nil))
+	diffLines := strings.Split(strings.TrimSuffix(diff, "\n"), "\n")
+	t.Assert(len(diffLines) == 2*n, "expected %d lines got %d", 2*n, len(diffLines))
+	t.Assert(diffLines[0] == "- a0" && diffLines[n-1] == fmt.Sprintf("- a%d", n-1), "expected the removed lines first got %v", diffLines[:2])
+	t.Assert(diffLines[n] == "+ b0" && diffLines[2*n-1] == fmt.Sprintf("+ b%d", n-1), "expected the added lines last got %v", diffLines[n:n+2])
+}
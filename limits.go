@@ -0,0 +1,162 @@
+package lexmachine
+
+import (
+	"context"
+	"fmt"
+	"go/token"
+	"time"
+)
+
+// Limits bounds the work done by a Scanner so that a pathological text can
+// not tie up the goroutine scanning it (see WithLimits). A zero field is no
+// limit.
+type Limits struct {
+	MaxTokens    int           // the number of tokens Next may return
+	MaxBytes     int           // the length of the text
+	MaxTokenTime time.Duration // the time the lexing engine may spend matching a single token
+}
+
+// A Limit identifies one of the fields of Limits.
+type Limit uint8
+
+const (
+	// TokenLimit is Limits.MaxTokens
+	TokenLimit Limit = iota + 1
+	// ByteLimit is Limits.MaxBytes
+	ByteLimit
+	// TimeLimit is Limits.MaxTokenTime
+	TimeLimit
+)
+
+// A LimitError is returned by Scanner.Next when the scan exceeds one of the
+// Limits of the Scanner.
+type LimitError struct {
+	Limit Limit     // the limit which was exceeded
+	Max   int64     // the value of the limit (a time.Duration for TimeLimit)
+	TC    int       // the text counter the scanner was at
+	Pos   token.Pos // the go/token position of TC (NoPos without a token.File)
+}
+
+func (e *LimitError) Error() string {
+	switch e.Limit {
+	case TokenLimit:
+		return fmt.Sprintf("Lexer error: more than %d tokens (at %d)", e.Max, e.TC)
+	case ByteLimit:
+		return fmt.Sprintf("Lexer error: the text is longer than %d bytes", e.Max)
+	default:
+		return fmt.Sprintf("Lexer error: matching the token at %d took longer than %v", e.TC, time.Duration(e.Max))
+	}
+}
+
+// A CanceledError is returned by Scanner.Next when the context of the Scanner
+// is done. It wraps the error of the context so errors.Is(err,
+// context.Canceled) and errors.Is(err, context.DeadlineExceeded) work.
+type CanceledError struct {
+	Err error     // the error of the context
+	TC  int       // the text counter the scanner was at
+	Pos token.Pos // the go/token position of TC (NoPos without a token.File)
+}
+
+func (e *CanceledError) Error() string {
+	return fmt.Sprintf("Lexer error: scan canceled at %d: %v", e.TC, e.Err)
+}
+
+// Unwrap returns the error of the context.
+func (e *CanceledError) Unwrap() error {
+	return e.Err
+}
+
+// WithContext stops the Scanner when ctx is done. Next checks ctx before each
+// token and the lexing engine checks it periodically while it matches a token
+// so a long scan stops promptly. Next then returns a *CanceledError. Actions
+// which do a lot of work themselves should check scan.Context() (the Actions
+// created by Nested and Heredoc do).
+func WithContext(ctx context.Context) ScannerOption {
+	return func(s *Scanner) {
+		s.ctx = ctx
+	}
+}
+
+// WithLimits bounds the work done by the Scanner. When a limit is exceeded
+// Next returns a *LimitError. The tokens limit counts the tokens returned by
+// Next (ScanParallel counts the tokens it returns) and the time limit is
+// checked periodically by the lexing engine (and by the Actions created by
+// Nested and Heredoc) while it matches a token. A text longer than the bytes
+// limit is rejected before it is copied: creating the Scanner (or the
+// TokenStream) fails with the *LimitError.
+func WithLimits(limits Limits) ScannerOption {
+	return func(s *Scanner) {
+		s.limits = limits
+	}
+}
+
+// Context returns the context of the Scanner (see WithContext). It is
+// context.Background() if the Scanner has no context.
+func (s *Scanner) Context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+// checkLimits checks the context and the limits which can be checked before
+// scanning a token.
+func (s *Scanner) checkLimits() error {
+	if err := s.canceled(); err != nil {
+		return err
+	}
+	if s.tooLong(s.Text) {
+		return s.limitError(ByteLimit, s.TC)
+	}
+	return nil
+}
+
+// tooLong returns true if text is longer than the MaxBytes limit.
+func (s *Scanner) tooLong(text []byte) bool {
+	return s.limits.MaxBytes > 0 && len(text) > s.limits.MaxBytes
+}
+
+// canceled returns a *CanceledError if the context of the scanner is done.
+func (s *Scanner) canceled() error {
+	if s.ctx == nil {
+		return nil
+	} else if err := s.ctx.Err(); err != nil {
+		return &CanceledError{Err: err, TC: s.TC, Pos: s.pos(s.TC)}
+	}
+	return nil
+}
+
+// countToken counts a token returned by Next against the tokens limit.
+func (s *Scanner) countToken() error {
+	if s.limits.MaxTokens > 0 && s.tokens >= s.limits.MaxTokens {
+		return s.limitError(TokenLimit, s.call.tc)
+	}
+	s.tokens++
+	return nil
+}
+
+// interrupt is called by the lexing engine while it matches a token starting
+// at s.TC. It stops the engine when the context is done or the token takes
+// too long.
+func (s *Scanner) interrupt() error {
+	if err := s.canceled(); err != nil {
+		return err
+	}
+	if s.limits.MaxTokenTime > 0 && time.Since(s.started) > s.limits.MaxTokenTime {
+		return s.limitError(TimeLimit, s.TC)
+	}
+	return nil
+}
+
+func (s *Scanner) limitError(limit Limit, tc int) *LimitError {
+	var max int64
+	switch limit {
+	case TokenLimit:
+		max = int64(s.limits.MaxTokens)
+	case ByteLimit:
+		max = int64(s.limits.MaxBytes)
+	case TimeLimit:
+		max = int64(s.limits.MaxTokenTime)
+	}
+	return &LimitError{Limit: limit, Max: max, TC: tc, Pos: s.pos(tc)}
+}
@@ -0,0 +1,239 @@
+package lexmachine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/timtadh/data-structures/test"
+	"github.com/timtadh/lexmachine/machines"
+)
+
+// countdownContext is canceled after its Err method has been called n times.
+type countdownContext struct {
+	context.Context
+	n int
+}
+
+func (c *countdownContext) Err() error {
+	if c.n <= 0 {
+		return context.Canceled
+	}
+	c.n--
+	return nil
+}
+
+func TestLimits(x *testing.T) {
+	t := (*test.T)(x)
+	newLexer := func() *Lexer {
+		lexer := NewLexer()
+		lexer.Add([]byte(`[a-z]+`), func(s *Scanner, m *machines.Match) (interface{}, error) {
+			return s.Token(0, string(m.Bytes), m), nil
+		})
+		lexer.Add([]byte(` +`), func(*Scanner, *machines.Match) (interface{}, error) {
+			return nil, nil
+		})
+		return lexer
+	}
+	scan := func(lexer *Lexer, text []byte, options ...ScannerOption) (toks []*Token, err error) {
+		scanner, err := lexer.Scanner(text, options...)
+		t.AssertNil(err)
+		for tok, err, eos := scanner.Next(); !eos; tok, err, eos = scanner.Next() {
+			if err != nil {
+				return toks, err
+			}
+			toks = append(toks, tok.(*Token))
+		}
+		return toks, nil
+	}
+	long := bytes.Repeat([]byte("a"), 4*machines.InterruptInterval)
+	runTest := func(lexer *Lexer) {
+		limits := WithLimits(Limits{MaxTokens: 2})
+		toks, err := scan(lexer, []byte("a b"), limits)
+		t.Assert(err == nil && len(toks) == 2, "expected 2 tokens got %v %v", toks, err)
+		toks, err = scan(lexer, []byte("a b c d"), limits)
+		t.Assert(len(toks) == 2, "expected 2 tokens got %v", toks)
+		l, is := err.(*LimitError)
+		t.Assert(is && l.Limit == TokenLimit && l.Max == 2 && l.TC == 3, "expected a tokens LimitError got %#v", err)
+		parallel, perr := lexer.ScanParallel([]byte("a b c d"), []int{2, 4}, 2, limits)
+		t.Assert(len(parallel) == 2, "expected 2 tokens got %v", parallel)
+		t.Assert(perr != nil && perr.Error() == err.Error(), "expected %v got %v", err, perr)
+
+		// the text is rejected before it is copied
+		bytesLimit := WithLimits(Limits{MaxBytes: 4})
+		_, err = lexer.Scanner([]byte("a b c"), bytesLimit)
+		l, is = err.(*LimitError)
+		t.Assert(is && l.Limit == ByteLimit && l.Max == 4, "expected a bytes LimitError got %#v", err)
+		_, err = lexer.TokenStream([]byte("a b c"), bytesLimit)
+		t.Assert(errors.As(err, &l) && l.Limit == ByteLimit, "expected a bytes LimitError got %#v", err)
+		parallel, err = lexer.ScanParallel([]byte("a b c"), nil, 2, bytesLimit)
+		t.Assert(len(parallel) == 0 && errors.As(err, &l) && l.Limit == ByteLimit, "expected a bytes LimitError got %v %#v", parallel, err)
+		toks, err = scan(lexer, []byte("a b"), bytesLimit)
+		t.Assert(err == nil && len(toks) == 2, "expected 2 tokens got %v %v", toks, err)
+		scanner, err := lexer.Scanner([]byte("a b"), bytesLimit)
+		t.AssertNil(err)
+		text := []byte("a b c")
+		scanner.Reset(text)
+		t.Assert(&scanner.Text[0] == &text[0], "expected the long text not to be copied")
+		_, err, _ = scanner.Next()
+		t.Assert(errors.As(err, &l) && l.Limit == ByteLimit, "expected a bytes LimitError got %#v", err)
+
+		_, err = scan(lexer, long, WithLimits(Limits{MaxTokenTime: time.Nanosecond}))
+		l, is = err.(*LimitError)
+		t.Assert(is && l.Limit == TimeLimit && l.TC == 0, "expected a time LimitError got %#v", err)
+		toks, err = scan(lexer, []byte("a b"), WithLimits(Limits{MaxTokenTime: time.Nanosecond}))
+		t.Assert(err == nil && len(toks) == 2, "short tokens are not interrupted, got %v %v", toks, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = scan(lexer, []byte("a b"), WithContext(ctx))
+		c, is := err.(*CanceledError)
+		t.Assert(is && c.TC == 0 && errors.Is(err, context.Canceled), "expected a CanceledError got %#v", err)
+
+		// canceled while the engine matches the long token
+		ctx = &countdownContext{Context: context.Background(), n: 3}
+		toks, err = scan(lexer, append([]byte("a "), long...), WithContext(ctx))
+		c, is = err.(*CanceledError)
+		t.Assert(len(toks) == 1 && is && c.TC == 2, "expected a CanceledError at 2 got %v %#v", toks, err)
+	}
+	{
+		lexer := newLexer()
+		t.AssertNil(lexer.CompileNFA())
+		runTest(lexer)
+	}
+	{
+		lexer := newLexer()
+		t.AssertNil(lexer.CompileDFA())
+		runTest(lexer)
+	}
+}
+
+func TestLimitsActions(x *testing.T) {
+	t := (*test.T)(x)
+	newLexer := func() *Lexer {
+		lexer := NewLexer()
+		lexer.Add([]byte(`/\*`), Nested([]byte("/*"), []byte("*/"), nil, func(s *Scanner, m *machines.Match) (interface{}, error) {
+			return s.Token(0, nil, m), nil
+		}))
+		lexer.Add([]byte(`<<EOF`), Heredoc(HeredocConfig{
+			Terminator: func([]byte) []byte { return []byte("EOF") },
+			Lines:      true,
+		}, func(s *Scanner, m *machines.Match, body []byte, bodyMatch *machines.Match) (interface{}, error) {
+			return s.Token(1, nil, m), nil
+		}))
+		lexer.Add([]byte(`( |\n)+`), func(*Scanner, *machines.Match) (interface{}, error) {
+			return nil, nil
+		})
+		return lexer
+	}
+	texts := [][]byte{
+		[]byte("/*" + strings.Repeat(" ", 4*machines.InterruptInterval) + "*/"),
+		[]byte("<<EOF\n" + strings.Repeat("\n", 4*machines.InterruptInterval) + "EOF"),
+	}
+	runTest := func(lexer *Lexer) {
+		for _, text := range texts {
+			scanner, err := lexer.Scanner(text)
+			t.AssertNil(err)
+			_, err, _ = scanner.Next()
+			t.AssertNil(err)
+
+			// the context is checked once by Next, then by the action
+			ctx := &countdownContext{Context: context.Background(), n: 1}
+			scanner, err = lexer.Scanner(text, WithContext(ctx))
+			t.AssertNil(err)
+			_, err, _ = scanner.Next()
+			c, is := err.(*CanceledError)
+			t.Assert(is && c.TC > 0, "%.10q: expected a CanceledError from the action got %#v", text, err)
+		}
+	}
+	{
+		lexer := newLexer()
+		t.AssertNil(lexer.CompileNFA())
+		runTest(lexer)
+	}
+	{
+		lexer := newLexer()
+		t.AssertNil(lexer.CompileDFA())
+		runTest(lexer)
+	}
+}
+
+func TestLimitsScanParallel(x *testing.T) {
+	t := (*test.T)(x)
+	var actions int64
+	newLexer := func() *Lexer {
+		lexer := NewLexer()
+		lexer.Add([]byte(`[a-z]+`), func(s *Scanner, m *machines.Match) (interface{}, error) {
+			atomic.AddInt64(&actions, 1)
+			return s.Token(0, string(m.Bytes), m), nil
+		})
+		lexer.Add([]byte(`/\*([^*]|\*+[^*/])*\*+/`), func(s *Scanner, m *machines.Match) (interface{}, error) {
+			atomic.AddInt64(&actions, 1)
+			return s.Token(1, string(m.Bytes), m), nil
+		})
+		lexer.Add([]byte(`( |\n)+`), func(*Scanner, *machines.Match) (interface{}, error) {
+			return nil, nil
+		})
+		return lexer
+	}
+	sequential := func(lexer *Lexer, text []byte, options ...ScannerOption) (toks []interface{}, err error) {
+		scanner, err := lexer.Scanner(text, options...)
+		t.AssertNil(err)
+		for tok, err, eos := scanner.Next(); !eos; tok, err, eos = scanner.Next() {
+			if err != nil {
+				return toks, err
+			}
+			toks = append(toks, tok)
+		}
+		return toks, nil
+	}
+	pieces := []string{"abc", " ", "\n", "/* a b\nc d e\nf g */"}
+	r := rand.New(rand.NewSource(5))
+	runTest := func(lexer *Lexer) {
+		// the chunks after the one which reached the limit are not lexed
+		text := bytes.Repeat([]byte("a b c d e f g h i j\n"), 100)
+		atomic.StoreInt64(&actions, 0)
+		toks, err := lexer.ScanParallel(text, nil, 1, WithLimits(Limits{MaxTokens: 5}))
+		l, is := err.(*LimitError)
+		t.Assert(len(toks) == 5 && is && l.Limit == TokenLimit, "expected 5 tokens and a tokens LimitError got %v %#v", toks, err)
+		t.Assert(atomic.LoadInt64(&actions) < 20, "expected the scan to stop early, %d actions ran", actions)
+
+		for trial := 0; trial < 200; trial++ {
+			var buf bytes.Buffer
+			for i := r.Intn(100); i > 0; i-- {
+				buf.WriteString(pieces[r.Intn(len(pieces))])
+			}
+			text := buf.Bytes()
+			limits := WithLimits(Limits{MaxTokens: 1 + r.Intn(20)})
+			expected, expectedErr := sequential(lexer, text, limits)
+			var boundaries []int
+			for b := r.Intn(7) + 1; b < len(text); b += r.Intn(13) + 1 {
+				boundaries = append(boundaries, b)
+			}
+			toks, err := lexer.ScanParallel(text, boundaries, 1+trial%3, limits)
+			t.Assert((err == nil) == (expectedErr == nil), "expected error %v got %v", expectedErr, err)
+			if err != nil {
+				t.Assert(err.Error() == expectedErr.Error(), "expected error %v got %v", expectedErr, err)
+			}
+			t.Assert(len(toks) == len(expected), "expected %d tokens got %d for %q", len(expected), len(toks), text)
+			for i := range toks {
+				t.Assert(toks[i].(*Token).Equals(expected[i].(*Token)), "expected %v got %v", expected[i], toks[i])
+			}
+		}
+	}
+	{
+		lexer := newLexer()
+		t.AssertNil(lexer.CompileNFA())
+		runTest(lexer)
+	}
+	{
+		lexer := newLexer()
+		t.AssertNil(lexer.CompileDFA())
+		runTest(lexer)
+	}
+}
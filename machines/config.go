@@ -0,0 +1,126 @@
+package machines
+
+import (
+	"github.com/timtadh/lexmachine/queue"
+)
+
+// Config configures the lexing engines. The zero value (or a nil *Config)
+// gives the default behavior.
+type Config struct {
+	Positions Positions // how lines and columns are computed
+	Buffers   *Buffers  // memory to reuse between scans (may be nil)
+	Trace     Tracer    // called for each step of the engine (may be nil)
+
+	// Shortest holds the match identifiers (the match-ids of a DFA or the pcs
+	// of the MATCH instructions of an NFA program) of the patterns which
+	// match the shortest lexeme rather than the longest. When such a pattern
+	// is the match at some point of the scan the engine stops there instead
+	// of looking for a longer match.
+	Shortest map[int]bool
+
+	// Interrupt is called periodically (every InterruptInterval bytes) while
+	// the engine matches a token (may be nil). If it returns an error the
+	// engine stops and the Scanner returns the error. The Scanner may then
+	// be called again.
+	Interrupt func() error
+}
+
+// InterruptInterval is the number of bytes an engine examines between the
+// calls to Config.Interrupt.
+const InterruptInterval = 256
+
+// Buffers holds the memory used by a lexing engine while it scans. Passing the
+// same Buffers to successive engines avoids reallocating this memory for every
+// text scanned. A Buffers may only be used by one engine at a time.
+type Buffers struct {
+	cqueue *queue.Queue
+	nqueue *queue.Queue
+	lines  lineIndex
+	forked bool // lines was shared by Fork and is kept by the next engine
+
+	lookahead int // see Lookahead
+}
+
+func (c *Config) buffers() *Buffers {
+	if c == nil || c.Buffers == nil {
+		return &Buffers{}
+	}
+	return c.Buffers
+}
+
+func (c *Config) tracer() Tracer {
+	if c == nil {
+		return nil
+	}
+	return c.Trace
+}
+
+func (c *Config) shortest() map[int]bool {
+	if c == nil {
+		return nil
+	}
+	return c.Shortest
+}
+
+func (c *Config) interrupt() func() error {
+	if c == nil {
+		return nil
+	}
+	return c.Interrupt
+}
+
+func (c *Config) positions() *Positions {
+	if c == nil {
+		return &Positions{}
+	}
+	return &c.Positions
+}
+
+// LineCol computes the line and column of tc in the text scanned by the
+// engine using the buffers. It shares (and extends) the engine's table of
+// line endings. A tc past the end of the text is reported as the position of
+// the last byte.
+func (b *Buffers) LineCol(tc int) (line, col int) {
+	return b.lines.lineCol(tc)
+}
+
+// EndLineCol computes the line and column just past the end of the text
+// scanned by the engine using the buffers (the position of the end of input).
+func (b *Buffers) EndLineCol() (line, col int) {
+	return b.lines.endLineCol()
+}
+
+// Lookahead returns one past the last byte of the text the engine using the
+// buffers examined to find the last match it returned (the match may depend
+// on the text up to there).
+func (b *Buffers) Lookahead() int {
+	return b.lookahead
+}
+
+// IndexLines indexes the line endings of the whole text scanned by the engine
+// using the buffers. Otherwise they are indexed as the engine reaches them.
+func (b *Buffers) IndexLines() {
+	b.lines.index(len(b.lines.text))
+}
+
+// Fork creates Buffers for another engine scanning the same text (with the
+// same Positions) as the engine using b, for instance concurrently from a
+// different text counter. The line endings indexed so far (see IndexLines)
+// are shared with the forked buffers so the text is not indexed again. So is
+// the position of the last text counter passed to LineCol: an engine forked
+// to scan from there does not walk its line from the start to compute the
+// columns. An engine must be using b when it is forked.
+func (b *Buffers) Fork() *Buffers {
+	f := &Buffers{lines: b.lines, forked: true}
+	// the shared line endings are read only, an append copies them
+	f.lines.ends = b.lines.ends[:len(b.lines.ends):len(b.lines.ends)]
+	return f
+}
+
+// queues returns the NFA simulation queues for a program of size n.
+func (b *Buffers) queues(n int) (*queue.Queue, *queue.Queue) {
+	if b.cqueue == nil || b.cqueue.Size() != n {
+		b.cqueue, b.nqueue = queue.New(n), queue.New(n)
+	}
+	return b.cqueue, b.nqueue
+}
@@ -8,32 +8,21 @@ type DFATrans [][256]int
 // belong to from the AST.
 type DFAAccepting map[int]int
 
-type lineCol struct {
-	line, col int
-}
-
-// Compute the line and column of a particular index inside of a byte slice.
-func mapLineCols(text []byte) []lineCol {
-	m := make([]lineCol, len(text))
-	line := 1
-	col := 0
-	for i := 0; i < len(text); i++ {
-		if text[i] == '\n' {
-			col = 0
-			line++
-		} else {
-			col++
-		}
-		m[i] = lineCol{line: line, col: col}
-	}
-	return m
-}
-
 // DFALexerEngine does the actual tokenization of the byte slice text using the
 // DFA state machine. If the lexing process fails the Scanner will return
 // an UnconsumedInput error.
 func DFALexerEngine(startState, errorState int, trans DFATrans, accepting DFAAccepting, text []byte) Scanner {
-	lineCols := mapLineCols(text)
+	return DFALexerEngineWithConfig(startState, errorState, trans, accepting, text, nil)
+}
+
+// DFALexerEngineWithConfig is a DFALexerEngine configured by config (which
+// may be nil).
+func DFALexerEngineWithConfig(startState, errorState int, trans DFATrans, accepting DFAAccepting, text []byte, config *Config) Scanner {
+	buffers := config.buffers()
+	lineCols := newLineIndex(text, config.positions(), buffers)
+	trace := config.tracer()
+	shortest := config.shortest()
+	interrupt := config.interrupt()
 	done := false
 	matchID := -1
 	matchTC := -1
@@ -54,30 +43,51 @@ func DFALexerEngine(startState, errorState int, trans DFATrans, accepting DFAAcc
 			matchTC = tc
 		}
 		state := startState
+		if trace != nil {
+			trace(TraceEvent{Kind: TraceStart, TC: tc, State: state})
+		}
 		for ; tc < len(text) && state != errorState; tc++ {
 			if match, has := accepting[state]; has {
+				if shortest[match] {
+					// stop at the shortest match, it is recorded below
+					break
+				}
 				matchID = match
 				matchTC = tc
+				if trace != nil {
+					trace(TraceEvent{Kind: TraceAccept, TC: tc, State: state, PC: match})
+				}
 			}
 			state = trans[state][text[tc]]
+			if trace != nil {
+				trace(TraceEvent{Kind: TraceStep, TC: tc + 1, State: state})
+			}
+			if interrupt != nil && (tc-startTC)%InterruptInterval == InterruptInterval-1 {
+				if err := interrupt(); err != nil {
+					matchID = -1
+					matchTC = -1
+					return startTC, nil, err, scan
+				}
+			}
 			if state == errorState && matchID > -1 {
-				startLC := lineCols[startTC]
-				endLC := lineCols[matchTC-1]
+				startLine, startCol := lineCols.lineCol(startTC)
+				endLine, endCol := lineCols.lineCol(matchTC - 1)
 				match := &Match{
 					PC:          matchID,
 					TC:          startTC,
-					StartLine:   startLC.line,
-					StartColumn: startLC.col,
-					EndLine:     endLC.line,
-					EndColumn:   endLC.col,
+					StartLine:   startLine,
+					StartColumn: startCol,
+					EndLine:     endLine,
+					EndColumn:   endCol,
 					Bytes:       text[startTC:matchTC],
 				}
+				buffers.lookahead = tc + 1
 				if matchTC == startTC {
 					err := &EmptyMatchError{
 						MatchID: matchID,
 						TC:      tc,
-						Line:    startLC.line,
-						Column:  startLC.col,
+						Line:    startLine,
+						Column:  startCol,
 					}
 					return startTC, nil, err, scan
 				}
@@ -88,33 +98,37 @@ func DFALexerEngine(startState, errorState int, trans DFATrans, accepting DFAAcc
 		if match, has := accepting[state]; has {
 			matchID = match
 			matchTC = tc
+			if trace != nil {
+				trace(TraceEvent{Kind: TraceAccept, TC: tc, State: state, PC: match})
+			}
 		}
 		if startTC <= len(text) && matchID > -1 && matchTC == startTC {
-			var startLC lineCol
+			var startLine, startCol int
 			if startTC < len(text) {
-				startLC = lineCols[startTC]
+				startLine, startCol = lineCols.lineCol(startTC)
 			}
 			err := &EmptyMatchError{
 				MatchID: matchID,
 				TC:      tc,
-				Line:    startLC.line,
-				Column:  startLC.col,
+				Line:    startLine,
+				Column:  startCol,
 			}
 			matchID = -1
 			return startTC, nil, err, scan
 		}
 		if startTC < len(text) && matchTC <= len(text) && matchID > -1 {
-			startLC := lineCols[startTC]
-			endLC := lineCols[matchTC-1]
+			startLine, startCol := lineCols.lineCol(startTC)
+			endLine, endCol := lineCols.lineCol(matchTC - 1)
 			match := &Match{
 				PC:          matchID,
 				TC:          startTC,
-				StartLine:   startLC.line,
-				StartColumn: startLC.col,
-				EndLine:     endLC.line,
-				EndColumn:   endLC.col,
+				StartLine:   startLine,
+				StartColumn: startCol,
+				EndLine:     endLine,
+				EndColumn:   endCol,
 				Bytes:       text[startTC:matchTC],
 			}
+			buffers.lookahead = tc
 			matchID = -1
 			return matchTC, match, nil, scan
 		}
@@ -127,21 +141,16 @@ func DFALexerEngine(startState, errorState int, trans DFATrans, accepting DFAAcc
 			if matchTC == -1 {
 				matchTC = 0
 			}
-			startLC := lineCols[startTC]
+			startLine, startCol := lineCols.lineCol(startTC)
 			etc := tc
-			var endLC lineCol
-			if etc >= len(lineCols) {
-				endLC = lineCols[len(lineCols)-1]
-			} else {
-				endLC = lineCols[etc]
-			}
+			failLine, failCol := lineCols.lineCol(etc)
 			err := &UnconsumedInput{
 				StartTC:     startTC,
 				FailTC:      etc,
-				StartLine:   startLC.line,
-				StartColumn: startLC.col,
-				FailLine:    endLC.line,
-				FailColumn:  endLC.col,
+				StartLine:   startLine,
+				StartColumn: startCol,
+				FailLine:    failLine,
+				FailColumn:  failCol,
 				Text:        text,
 			}
 			return tc, nil, err, scan
@@ -4,11 +4,11 @@ package machines
 import (
 	"bytes"
 	"fmt"
+	"go/token"
 )
 
 import (
 	"github.com/timtadh/lexmachine/inst"
-	"github.com/timtadh/lexmachine/queue"
 )
 
 // EmptyMatchError is returned when a pattern would have matched the empty
@@ -18,6 +18,7 @@ type EmptyMatchError struct {
 	Line    int
 	Column  int
 	MatchID int
+	Pos     token.Pos // set by the lexmachine.Scanner when it has a token.File
 }
 
 func (e *EmptyMatchError) Error() string {
@@ -35,6 +36,8 @@ type UnconsumedInput struct {
 	FailLine    int
 	FailColumn  int
 	Text        []byte
+	StartPos    token.Pos // set by the lexmachine.Scanner when it has a token.File
+	FailPos     token.Pos // set by the lexmachine.Scanner when it has a token.File
 }
 
 // Error implements the error interface
@@ -68,43 +71,8 @@ type Match struct {
 	StartColumn int
 	EndLine     int
 	EndColumn   int
-	Bytes       []byte // the actual bytes matched during scanning.
-}
-
-func computeLineCol(text []byte, prevTC, tc, line, col int) (int, int) {
-	if tc < 0 {
-		return line, col
-	}
-	if tc < prevTC {
-		for i := prevTC; i > tc && i > 0; i-- {
-			if text[i] == '\n' {
-				line--
-			}
-		}
-		col = 0
-		for i := tc; i >= 0; i-- {
-			if text[i] == '\n' {
-				break
-			}
-			col++
-		}
-		return line, col
-	}
-	for i := prevTC + 1; i <= tc && i < len(text); i++ {
-		if text[i] == '\n' {
-			col = 0
-			line++
-		} else {
-			col++
-		}
-	}
-	if prevTC == tc && tc == 0 && tc < len(text) {
-		if text[tc] == '\n' {
-			line++
-			col--
-		}
-	}
-	return line, col
+	Bytes       []byte    // the actual bytes matched during scanning.
+	Pos         token.Pos // the go/token position of TC (NoPos unless the scanner has a token.File)
 }
 
 // Equals checks two matches for equality
@@ -137,16 +105,24 @@ type Scanner func(int) (int, *Match, error, Scanner)
 // NFA bytecode in program. If the lexing process fails the Scanner will return
 // an UnconsumedInput error.
 func LexerEngine(program inst.Slice, text []byte) Scanner {
+	return LexerEngineWithConfig(program, text, nil)
+}
+
+// LexerEngineWithConfig is a LexerEngine configured by config (which may be
+// nil).
+func LexerEngineWithConfig(program inst.Slice, text []byte, config *Config) Scanner {
 	done := false
 	matchPC := -1
 	matchTC := -1
 
-	prevTC := 0
-	line := 1
-	col := 1
+	buffers := config.buffers()
+	lineCols := newLineIndex(text, config.positions(), buffers)
+	trace := config.tracer()
+	shortest := config.shortest()
+	interrupt := config.interrupt()
 
 	var scan Scanner
-	var cqueue, nqueue *queue.Queue = queue.New(len(program)), queue.New(len(program))
+	cqueue, nqueue := buffers.queues(len(program))
 	scan = func(tc int) (int, *Match, error, Scanner) {
 		if done && tc == len(text) {
 			return tc, nil, nil, nil
@@ -164,6 +140,9 @@ func LexerEngine(program inst.Slice, text []byte) Scanner {
 		cqueue.Clear()
 		nqueue.Clear()
 		cqueue.Push(0)
+		if trace != nil {
+			trace(TraceEvent{Kind: TraceStart, TC: tc, State: cqueue.Len()})
+		}
 		for ; tc <= len(text); tc++ {
 			if cqueue.Empty() {
 				break
@@ -179,12 +158,12 @@ func LexerEngine(program inst.Slice, text []byte) Scanner {
 						nqueue.Push(pc + 1)
 					}
 				case inst.MATCH:
-					if matchTC < tc {
-						matchPC = int(pc)
-						matchTC = tc
-					} else if matchPC > int(pc) {
+					if matchTC < tc || matchPC > int(pc) {
 						matchPC = int(pc)
 						matchTC = tc
+						if trace != nil {
+							trace(TraceEvent{Kind: TraceAccept, TC: tc, State: -1, PC: matchPC})
+						}
 					}
 				case inst.JMP:
 					cqueue.Push(i.X)
@@ -196,9 +175,23 @@ func LexerEngine(program inst.Slice, text []byte) Scanner {
 				}
 			}
 			cqueue, nqueue = nqueue, cqueue
+			nqueue.Clear()
+			if matchTC == tc && shortest[matchPC] {
+				// stop at the shortest match by stopping every thread
+				cqueue.Clear()
+			} else if trace != nil && tc < len(text) {
+				trace(TraceEvent{Kind: TraceStep, TC: tc + 1, State: cqueue.Len()})
+			}
+			if interrupt != nil && (tc-startTC)%InterruptInterval == InterruptInterval-1 {
+				if err := interrupt(); err != nil {
+					matchPC = -1
+					matchTC = -1
+					return startTC, nil, err, scan
+				}
+			}
 			if cqueue.Empty() && matchPC > -1 {
-				line, col = computeLineCol(text, prevTC, startTC, line, col)
-				eLine, eCol := computeLineCol(text, startTC, matchTC-1, line, col)
+				line, col := lineCols.lineCol(startTC)
+				eLine, eCol := lineCols.lineCol(matchTC - 1)
 				match := &Match{
 					PC:          matchPC,
 					TC:          startTC,
@@ -208,6 +201,7 @@ func LexerEngine(program inst.Slice, text []byte) Scanner {
 					EndColumn:   eCol,
 					Bytes:       text[startTC:matchTC],
 				}
+				buffers.lookahead = tc + 1
 				if matchTC == startTC {
 					err := &EmptyMatchError{
 						MatchID: matchPC,
@@ -217,7 +211,6 @@ func LexerEngine(program inst.Slice, text []byte) Scanner {
 					}
 					return startTC, nil, err, scan
 				}
-				prevTC = startTC
 				matchPC = -1
 				return matchTC, match, nil, scan
 			}
@@ -231,8 +224,12 @@ func LexerEngine(program inst.Slice, text []byte) Scanner {
 			if matchTC == -1 {
 				matchTC = 0
 			}
-			sline, scol := computeLineCol(text, 0, startTC, 1, 1)
-			fline, fcol := computeLineCol(text, 0, tc, 1, 1)
+			if tc > len(text) {
+				// the threads were still running at the end of the text
+				tc = len(text)
+			}
+			sline, scol := lineCols.lineCol(startTC)
+			fline, fcol := lineCols.lineCol(tc)
 			err := &UnconsumedInput{
 				StartTC:     startTC,
 				FailTC:      tc,
@@ -1,5 +1,7 @@
 package machines
 
+import "bytes"
+import "fmt"
 import "testing"
 import "github.com/timtadh/lexmachine/inst"
 
@@ -31,7 +33,7 @@ func TestLexerMatch(t *testing.T) {
 	t.Log(program)
 	mtext := []byte("ababcbcbb")
 	expected := []Match{
-		{16, 0, 1, 1, 1, len(mtext), mtext},
+		{PC: 16, TC: 0, StartLine: 1, StartColumn: 1, EndLine: 1, EndColumn: len(mtext), Bytes: mtext},
 	}
 	i := 0
 	for tc, m, err, scan := LexerEngine(program, text)(0); scan != nil; tc, m, err, scan = scan(tc) {
@@ -111,9 +113,9 @@ func TestLexerThreeStrings(t *testing.T) {
 	t.Log(len(text))
 	t.Log(program)
 	expected := []Match{
-		{8, 0, 1, 1, 1, 6, []byte("struct")},
-		{13, 6, 1, 7, 1, 8, []byte("  ")},
-		{15, 8, 1, 9, 1, 9, []byte("*")},
+		{PC: 8, TC: 0, StartLine: 1, StartColumn: 1, EndLine: 1, EndColumn: 6, Bytes: []byte("struct")},
+		{PC: 13, TC: 6, StartLine: 1, StartColumn: 7, EndLine: 1, EndColumn: 8, Bytes: []byte("  ")},
+		{PC: 15, TC: 8, StartLine: 1, StartColumn: 9, EndLine: 1, EndColumn: 9, Bytes: []byte("*")},
 	}
 
 	i := 0
@@ -162,9 +164,9 @@ func TestLexerRestart(t *testing.T) {
 	t.Log(len(text))
 	t.Log(program)
 	expected := []Match{
-		{8, 0, 1, 1, 1, 6, []byte("struct")},
-		{19, 6, 2, 0, 2, 2, []byte("\n  ")},
-		{21, 9, 2, 3, 2, 3, []byte("*")},
+		{PC: 8, TC: 0, StartLine: 1, StartColumn: 1, EndLine: 1, EndColumn: 6, Bytes: []byte("struct")},
+		{PC: 19, TC: 6, StartLine: 2, StartColumn: 0, EndLine: 2, EndColumn: 2, Bytes: []byte("\n  ")},
+		{PC: 21, TC: 9, StartLine: 2, StartColumn: 3, EndLine: 2, EndColumn: 3, Bytes: []byte("*")},
 	}
 
 	check := func(m *Match, i int, err error) {
@@ -217,3 +219,131 @@ func TestLexerRestart(t *testing.T) {
 		t.Error("unconsumed matches", expected[i-1:])
 	}
 }
+
+func TestShortest(t *testing.T) {
+	text := []byte("aaa")
+	// a+
+	program := inst.Slice{
+		inst.New(inst.CHAR, 'a', 'a'),
+		inst.New(inst.SPLIT, 0, 2),
+		inst.New(inst.MATCH, 0, 0),
+	}
+	trans := make(DFATrans, 3)
+	trans[1]['a'] = 2
+	trans[2]['a'] = 2
+	accepting := DFAAccepting{2: 0}
+	engines := map[string]Scanner{
+		"nfa": LexerEngineWithConfig(program, text, &Config{Shortest: map[int]bool{2: true}}),
+		"dfa": DFALexerEngineWithConfig(1, 0, trans, accepting, text, &Config{Shortest: map[int]bool{0: true}}),
+	}
+	for name, scan := range engines {
+		i := 0
+		for tc, m, err, scan := scan(0); scan != nil; tc, m, err, scan = scan(tc) {
+			if err != nil {
+				t.Fatal(name, err)
+			} else if string(m.Bytes) != "a" || m.TC != i {
+				t.Errorf("%s: expected the match of a at %d got %v", name, i, m)
+			}
+			i++
+		}
+		if i != len(text) {
+			t.Errorf("%s: expected %d matches got %d", name, len(text), i)
+		}
+	}
+}
+
+func TestInterrupt(t *testing.T) {
+	text := bytes.Repeat([]byte("a"), 3*InterruptInterval)
+	// a+
+	program := inst.Slice{
+		inst.New(inst.CHAR, 'a', 'a'),
+		inst.New(inst.SPLIT, 0, 2),
+		inst.New(inst.MATCH, 0, 0),
+	}
+	trans := make(DFATrans, 3)
+	trans[1]['a'] = 2
+	trans[2]['a'] = 2
+	accepting := DFAAccepting{2: 0}
+	stop := fmt.Errorf("stop")
+	calls := 0
+	config := &Config{
+		Interrupt: func() error {
+			calls++
+			if calls == 2 {
+				return stop
+			}
+			return nil
+		},
+	}
+	engines := map[string]Scanner{
+		"nfa": LexerEngineWithConfig(program, text, config),
+		"dfa": DFALexerEngineWithConfig(1, 0, trans, accepting, text, config),
+	}
+	for name, scan := range engines {
+		calls = 0
+		tc, m, err, scan := scan(0)
+		if err != stop || m != nil || tc != 0 {
+			t.Fatalf("%s: expected the interrupt at 0 got %d %v %v", name, tc, m, err)
+		}
+		// the engine may be called again after an interrupt
+		tc, m, err, scan = scan(tc)
+		if err != nil || m == nil || len(m.Bytes) != len(text) || scan == nil {
+			t.Fatalf("%s: expected the match of the text got %d %v %v", name, tc, m, err)
+		}
+		if calls != 5 {
+			t.Errorf("%s: expected 5 calls to Interrupt got %d", name, calls)
+		}
+	}
+}
+
+func TestLexerEpsilonCycle(t *testing.T) {
+	// (a*)*b the inner star can loop back to the outer one without reading
+	// a character
+	program := make(inst.Slice, 7)
+	program[0] = inst.New(inst.SPLIT, 1, 5)
+	program[1] = inst.New(inst.SPLIT, 2, 4)
+	program[2] = inst.New(inst.CHAR, 'a', 'a')
+	program[3] = inst.New(inst.JMP, 1, 0)
+	program[4] = inst.New(inst.JMP, 0, 0)
+	program[5] = inst.New(inst.CHAR, 'b', 'b')
+	program[6] = inst.New(inst.MATCH, 0, 0)
+
+	for _, text := range []string{"b", "aab"} {
+		_, m, err, _ := LexerEngine(program, []byte(text))(0)
+		if err != nil {
+			t.Fatal(err)
+		} else if m == nil || string(m.Bytes) != text {
+			t.Fatalf("expected %q to match got %v", text, m)
+		}
+	}
+}
+
+func TestLookahead(t *testing.T) {
+	text := []byte("aab")
+	// a+
+	program := inst.Slice{
+		inst.New(inst.CHAR, 'a', 'a'),
+		inst.New(inst.SPLIT, 0, 2),
+		inst.New(inst.MATCH, 0, 0),
+	}
+	trans := make(DFATrans, 3)
+	trans[1]['a'] = 2
+	trans[2]['a'] = 2
+	accepting := DFAAccepting{2: 0}
+	nfa, dfa := &Config{Buffers: &Buffers{}}, &Config{Buffers: &Buffers{}}
+	engines := map[string]Scanner{
+		"nfa": LexerEngineWithConfig(program, text, nfa),
+		"dfa": DFALexerEngineWithConfig(1, 0, trans, accepting, text, dfa),
+	}
+	buffers := map[string]*Buffers{"nfa": nfa.Buffers, "dfa": dfa.Buffers}
+	for name, scan := range engines {
+		_, m, err, _ := scan(0)
+		if err != nil || m == nil || string(m.Bytes) != "aa" {
+			t.Fatalf("%s: expected the match of aa got %v %v", name, m, err)
+		}
+		// the b was examined to end the match
+		if l := buffers[name].Lookahead(); l != 3 {
+			t.Errorf("%s: expected the lookahead 3 got %d", name, l)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package machines
+
+import (
+	"bytes"
+	"sort"
+)
+
+// ColumnUnit selects what a column number counts.
+type ColumnUnit uint8
+
+const (
+	// ByteColumns counts bytes (the default)
+	ByteColumns ColumnUnit = iota
+	// RuneColumns counts UTF-8 encoded code points
+	RuneColumns
+	// UTF16Columns counts UTF-16 code units (as the Language Server Protocol
+	// does). Code points outside of the basic multilingual plane count twice.
+	UTF16Columns
+)
+
+// Newlines selects which byte sequences end a line. A \n always ends a line.
+type Newlines uint8
+
+const (
+	// LF only recognizes \n as a line ending (the default). A \r is counted as
+	// an ordinary character.
+	LF Newlines = 0
+	// CRLF also treats \r\n as a single line ending.
+	CRLF Newlines = 1
+	// CR treats \n, \r\n and a lone \r as line endings.
+	CR Newlines = 2
+)
+
+// Positions configures how the lexing engines compute the line and column
+// numbers reported in a Match. The zero value counts bytes, treats a tab as a
+// single column and only recognizes \n as a line ending.
+//
+// Lines and columns start at 1. The bytes of a line ending are reported as
+// column 0 of the line they start.
+type Positions struct {
+	Columns  ColumnUnit
+	TabWidth int // tabs advance to the next multiple of TabWidth. (0 and 1 mean no expansion)
+	Newlines Newlines
+}
+
+// cursor tracks the line and column of a text counter as it is moved forward
+// through the text.
+type cursor struct {
+	tc    int
+	line  int
+	col   int
+	width int // the number of columns occupied by the character at tc
+}
+
+func newCursor() cursor {
+	return cursor{tc: -1, line: 1, col: 0, width: 1}
+}
+
+// advance moves the cursor forward to tc (or the last byte of the text if tc
+// is past the end of the text).
+func (c *cursor) advance(text []byte, p *Positions, tc int) {
+	for i := c.tc + 1; i <= tc && i < len(text); i++ {
+		b := text[i]
+		switch {
+		case p.lineEndContinues(text, i):
+			// the \n of a \r\n shares the position of the \r
+		case p.lineEndStarts(text, i):
+			c.line++
+			c.col = 0
+			c.width = 1
+		case p.Columns != ByteColumns && b&0xc0 == 0x80:
+			// a UTF-8 continuation byte shares the column of its code point
+		default:
+			c.col += c.width
+			c.width = p.width(b, c.col)
+		}
+		c.tc = i
+	}
+}
+
+// lineEndStarts checks if the byte at i begins a line ending.
+func (p *Positions) lineEndStarts(text []byte, i int) bool {
+	switch text[i] {
+	case '\n':
+		return true
+	case '\r':
+		if p.Newlines == CR {
+			return true
+		}
+		return p.Newlines == CRLF && i+1 < len(text) && text[i+1] == '\n'
+	}
+	return false
+}
+
+// lineEndContinues checks if the byte at i is the \n of a \r\n line ending.
+func (p *Positions) lineEndContinues(text []byte, i int) bool {
+	return p.Newlines != LF && text[i] == '\n' && i > 0 && text[i-1] == '\r'
+}
+
+// width computes the number of columns occupied by the character starting
+// with b at column col.
+func (p *Positions) width(b byte, col int) int {
+	if b == '\t' && p.TabWidth > 1 {
+		return p.TabWidth - (col-1)%p.TabWidth
+	}
+	if p.Columns == UTF16Columns && b >= 0xf0 {
+		return 2
+	}
+	return 1
+}
+
+// lineIndex computes the line and column of text counters. It records the
+// text counter of each line ending as the text is scanned (rather than
+// mapping every byte) and finds the line of a text counter with a binary
+// search. The column is computed by walking forward from the start of the
+// line or from the last position computed, whichever is closer.
+type lineIndex struct {
+	text      []byte
+	positions *Positions
+	ends      []int // the text counter of the first byte of each line ending
+	indexed   int   // the text has been indexed up to (but not including) here
+	last      cursor
+}
+
+func newLineIndex(text []byte, positions *Positions, buffers *Buffers) *lineIndex {
+	x := &buffers.lines
+	if buffers.forked {
+		// keep the line endings shared by Buffers.Fork
+		buffers.forked = false
+		x.positions = positions
+		return x
+	}
+	*x = lineIndex{
+		text:      text,
+		positions: positions,
+		ends:      x.ends[:0],
+		last:      newCursor(),
+	}
+	return x
+}
+
+// index records the line endings in the text up to and including tc.
+func (x *lineIndex) index(tc int) {
+	p := x.positions
+	if p.Newlines == LF {
+		// only a \n ends a line so they can be searched for directly
+		end := tc + 1
+		if end > len(x.text) {
+			end = len(x.text)
+		}
+		for x.indexed < end {
+			i := bytes.IndexByte(x.text[x.indexed:end], '\n')
+			if i < 0 {
+				x.indexed = end
+				break
+			}
+			x.ends = append(x.ends, x.indexed+i)
+			x.indexed += i + 1
+		}
+		return
+	}
+	for ; x.indexed <= tc && x.indexed < len(x.text); x.indexed++ {
+		i := x.indexed
+		if p.lineEndStarts(x.text, i) && !p.lineEndContinues(x.text, i) {
+			x.ends = append(x.ends, i)
+		}
+	}
+}
+
+// lineCol returns the line and column of tc. A tc past the end of the text is
+// reported as the position of the last byte.
+func (x *lineIndex) lineCol(tc int) (line, col int) {
+	if tc >= len(x.text) {
+		tc = len(x.text) - 1
+	}
+	x.index(tc)
+	// the number of line endings which start at or before tc
+	n := sort.Search(len(x.ends), func(i int) bool {
+		return x.ends[i] > tc
+	})
+	line = n + 1
+	if x.last.tc > tc || x.last.line != line {
+		if n == 0 {
+			x.last = newCursor()
+		} else {
+			x.last = cursor{tc: x.ends[n-1], line: line, col: 0, width: 1}
+		}
+	}
+	x.last.advance(x.text, x.positions, tc)
+	return x.last.line, x.last.col
+}
+
+// endLineCol returns the line and column just past the end of the text.
+func (x *lineIndex) endLineCol() (line, col int) {
+	x.lineCol(len(x.text) - 1)
+	return x.last.line, x.last.col + x.last.width
+}
@@ -0,0 +1,131 @@
+package machines
+
+import (
+	"bytes"
+	"math/rand"
+	"runtime"
+	"testing"
+)
+
+// mapLineCols eagerly computes the line and column of every byte in the text.
+// It is the reference the lineIndex is checked against.
+func mapLineCols(text []byte, positions *Positions) [][2]int {
+	m := make([][2]int, len(text))
+	pos := newCursor()
+	for i := 0; i < len(text); i++ {
+		pos.advance(text, positions, i)
+		m[i] = [2]int{pos.line, pos.col}
+	}
+	return m
+}
+
+func TestLineIndex(t *testing.T) {
+	alphabet := []byte("ab\t\n\r\xc3\xa9\xf0\x9f\x98\x80")
+	configs := []Positions{
+		{},
+		{Columns: RuneColumns, TabWidth: 4, Newlines: CRLF},
+		{Columns: UTF16Columns, TabWidth: 8, Newlines: CR},
+	}
+	r := rand.New(rand.NewSource(1))
+	for trial := 0; trial < 50; trial++ {
+		text := make([]byte, r.Intn(200))
+		for i := range text {
+			text[i] = alphabet[r.Intn(len(alphabet))]
+		}
+		for _, config := range configs {
+			config := config
+			expected := mapLineCols(text, &config)
+			x := newLineIndex(text, &config, &Buffers{})
+			// mostly move forward (as the engines do) but sometimes backtrack
+			tc := 0
+			for i := 0; i < 2*len(text); i++ {
+				if r.Intn(5) == 0 {
+					tc = r.Intn(len(text))
+				} else if tc+1 < len(text) {
+					tc++
+				}
+				line, col := x.lineCol(tc)
+				if line != expected[tc][0] || col != expected[tc][1] {
+					t.Fatalf("%q %v: at %d expected %v got (%d, %d)", text, config, tc, expected[tc], line, col)
+				}
+			}
+			// the end of the text is where another character would be
+			end := mapLineCols(append(text[:len(text):len(text)], 'x'), &config)[len(text)]
+			if line, col := x.endLineCol(); line != end[0] || col != end[1] {
+				t.Fatalf("%q %v: at the end expected %v got (%d, %d)", text, config, end, line, col)
+			}
+		}
+	}
+}
+
+func TestBuffersFork(t *testing.T) {
+	alphabet := []byte("ab\t\n\r\xc3\xa9")
+	configs := []Positions{
+		{},
+		{Columns: RuneColumns, TabWidth: 4, Newlines: CRLF},
+		{Newlines: CR},
+	}
+	r := rand.New(rand.NewSource(2))
+	for trial := 0; trial < 50; trial++ {
+		text := make([]byte, r.Intn(200)+1)
+		for i := range text {
+			text[i] = alphabet[r.Intn(len(alphabet))]
+		}
+		for _, config := range configs {
+			config := config
+			expected := mapLineCols(text, &config)
+			buffers := &Buffers{}
+			newLineIndex(text, &config, buffers)
+			buffers.IndexLines()
+			start := r.Intn(len(text))
+			if start > 0 {
+				buffers.LineCol(start - 1)
+			}
+			fork := buffers.Fork()
+			x := newLineIndex(text, &config, fork)
+			if x.indexed != len(text) || len(x.ends) != len(buffers.lines.ends) {
+				t.Fatalf("%q %v: the fork did not keep the index", text, config)
+			}
+			for tc := start; tc < len(text); tc++ {
+				line, col := fork.LineCol(tc)
+				if line != expected[tc][0] || col != expected[tc][1] {
+					t.Fatalf("%q %v: forked at %d, at %d expected %v got (%d, %d)", text, config, start, tc, expected[tc], line, col)
+				}
+			}
+		}
+	}
+}
+
+// benchmarkPositions measures the cost of computing the positions of a single
+// token spanning the whole text, without the rest of the lexing machinery.
+func benchmarkPositions(b *testing.B, positions func(text []byte)) {
+	line := []byte("the quick brown fox jumped over 1234 lazy dogs and 56 cats\n")
+	text := bytes.Repeat(line, 1<<14)
+	b.SetBytes(int64(len(text)))
+	b.ReportAllocs()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		positions(text)
+	}
+	b.StopTimer()
+	runtime.ReadMemStats(&after)
+	b.ReportMetric(float64(after.TotalAlloc-before.TotalAlloc)/float64(b.N*len(text)), "B/input-byte")
+}
+
+func BenchmarkLineIndex(b *testing.B) {
+	benchmarkPositions(b, func(text []byte) {
+		x := newLineIndex(text, &Positions{}, &Buffers{})
+		x.lineCol(0)
+		x.lineCol(len(text) - 1)
+	})
+}
+
+// BenchmarkMapLineCols is the cost of the per-byte table the engines used to
+// build before every scan.
+func BenchmarkMapLineCols(b *testing.B) {
+	benchmarkPositions(b, func(text []byte) {
+		mapLineCols(text, &Positions{})
+	})
+}
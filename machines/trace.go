@@ -0,0 +1,49 @@
+package machines
+
+import (
+	"fmt"
+)
+
+// TraceKind is the kind of a TraceEvent
+type TraceKind uint8
+
+const (
+	// TraceStart is reported when the engine starts looking for a match at
+	// TC. State is the start state.
+	TraceStart TraceKind = iota
+	// TraceStep is reported after the engine reads the byte at TC-1. State is
+	// the state it moved to.
+	TraceStep
+	// TraceAccept is reported when the engine records the longest match so
+	// far: the text up to TC matches PC (the match id for the DFA, the
+	// program counter of the MATCH instruction for the NFA, as in Match.PC).
+	TraceAccept
+)
+
+// TraceEvent is a step taken by a lexing engine while it looks for a match.
+// For the DFA engine State is the DFA state. For the NFA engine, which is in
+// many states at once, State is the number of threads still running.
+type TraceEvent struct {
+	Kind  TraceKind
+	TC    int
+	State int
+	PC    int // set for TraceAccept
+}
+
+// String formats the event for humans
+func (e TraceEvent) String() string {
+	switch e.Kind {
+	case TraceStart:
+		return fmt.Sprintf("start at %d in state %d", e.TC, e.State)
+	case TraceStep:
+		return fmt.Sprintf("read %d: state %d", e.TC-1, e.State)
+	case TraceAccept:
+		return fmt.Sprintf("accept the text up to %d as %d", e.TC, e.PC)
+	}
+	return fmt.Sprintf("unknown event %d", e.Kind)
+}
+
+// Tracer receives the steps of a lexing engine. It is called synchronously
+// from the engine so it should be quick. Tracing slows the engines down
+// considerably; it is intended for debugging lexers.
+type Tracer func(event TraceEvent)
@@ -0,0 +1,92 @@
+package lexmachine
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+
+	"github.com/timtadh/lexmachine/machines"
+)
+
+// An UnterminatedError is returned by an Action created with Nested when the
+// text ends before the region it started was closed.
+type UnterminatedError struct {
+	Open        []byte    // the text matched by the pattern which opened the region
+	Close       []byte    // the closing delimiter which was expected
+	Depth       int       // the number of regions still open at the end of the text
+	StartTC     int       // the text counter of the start of the region
+	StartLine   int       // the line of the start of the region
+	StartColumn int       // the column of the start of the region
+	StartPos    token.Pos // the go/token position of StartTC (NoPos without a token.File)
+}
+
+func (e *UnterminatedError) Error() string {
+	missing := fmt.Sprintf("%q", e.Close)
+	if e.Depth > 1 {
+		missing = fmt.Sprintf("%d more %q", e.Depth, e.Close)
+	}
+	return fmt.Sprintf("Lexer error: unterminated %q starting at %d:%d, expected %s",
+		e.Open, e.StartLine, e.StartColumn, missing)
+}
+
+// Nested creates an Action which consumes a balanced region of the text such
+// as a nested comment. Add it with a pattern matching the opening delimiter.
+// The text following the match is scanned for the close delimiter, each open
+// delimiter found on the way must be closed first. The bytes following an
+// escape are skipped. When the region is closed the match is extended to
+// cover the whole region (including its position information) and passed to
+// action, the Scanner resumes after the region. If the text ends first an
+// *UnterminatedError is returned.
+//
+// A nil open creates a region which does not nest, a nil escape disables
+// escapes. For example:
+//
+//     lexer.Add([]byte(`/\*`), lexmachine.Nested([]byte("/*"), []byte("*/"), nil, skip))
+//     lexer.Add([]byte(`"`), lexmachine.Nested(nil, []byte(`"`), []byte(`\`), token("STRING")))
+//
+// The close delimiter is looked for before the open delimiter so they may be
+// the same. Nested panics if close is empty.
+func Nested(open, close, escape []byte, action Action) Action {
+	if len(close) == 0 {
+		panic(fmt.Errorf("Nested requires a close delimiter"))
+	}
+	return func(scan *Scanner, match *machines.Match) (interface{}, error) {
+		depth := 1
+		for tc, n := scan.TC, 1; tc < len(scan.Text); n++ {
+			if n%machines.InterruptInterval == 0 {
+				// stop a long region when the scan is canceled
+				if err := scan.interrupt(); err != nil {
+					return nil, err
+				}
+			}
+			rest := scan.Text[tc:]
+			switch {
+			case len(escape) > 0 && bytes.HasPrefix(rest, escape):
+				tc += len(escape) + 1
+			case bytes.HasPrefix(rest, close):
+				tc += len(close)
+				depth--
+				if depth == 0 {
+					if err := scan.ExtendMatch(match, tc); err != nil {
+						return nil, err
+					}
+					return action(scan, match)
+				}
+			case len(open) > 0 && bytes.HasPrefix(rest, open):
+				tc += len(open)
+				depth++
+			default:
+				tc++
+			}
+		}
+		return nil, &UnterminatedError{
+			Open:        match.Bytes,
+			Close:       close,
+			Depth:       depth,
+			StartTC:     match.TC,
+			StartLine:   match.StartLine,
+			StartColumn: match.StartColumn,
+			StartPos:    match.Pos,
+		}
+	}
+}
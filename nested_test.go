@@ -0,0 +1,66 @@
+package lexmachine
+
+import (
+	"testing"
+
+	"github.com/timtadh/data-structures/test"
+	"github.com/timtadh/lexmachine/machines"
+)
+
+func TestNested(x *testing.T) {
+	t := (*test.T)(x)
+	token := func(typ int) Action {
+		return func(s *Scanner, m *machines.Match) (interface{}, error) {
+			return s.Token(typ, string(m.Bytes), m), nil
+		}
+	}
+	newLexer := func() *Lexer {
+		lexer := NewLexer()
+		lexer.Add([]byte(`/\*`), Nested([]byte("/*"), []byte("*/"), nil, token(0)))
+		lexer.Add([]byte(`"`), Nested(nil, []byte(`"`), []byte(`\`), token(1)))
+		lexer.Add([]byte(`[a-z]+`), token(2))
+		lexer.Add([]byte(`( |\n)+`), func(*Scanner, *machines.Match) (interface{}, error) {
+			return nil, nil
+		})
+		return lexer
+	}
+	text := []byte("a /* b /* c */\n*/ d \"e \\\" f\" /**/")
+	expected := []*Token{
+		{Type: 2, Value: "a", Lexeme: []byte("a"), TC: 0, StartLine: 1, StartColumn: 1, EndLine: 1, EndColumn: 1},
+		{Type: 0, Value: "/* b /* c */\n*/", Lexeme: []byte("/* b /* c */\n*/"), TC: 2, StartLine: 1, StartColumn: 3, EndLine: 2, EndColumn: 2},
+		{Type: 2, Value: "d", Lexeme: []byte("d"), TC: 18, StartLine: 2, StartColumn: 4, EndLine: 2, EndColumn: 4},
+		{Type: 1, Value: `"e \" f"`, Lexeme: []byte(`"e \" f"`), TC: 20, StartLine: 2, StartColumn: 6, EndLine: 2, EndColumn: 13},
+		{Type: 0, Value: "/**/", Lexeme: []byte("/**/"), TC: 29, StartLine: 2, StartColumn: 15, EndLine: 2, EndColumn: 18},
+	}
+	runTest := func(lexer *Lexer) {
+		scanner, err := lexer.Scanner(text)
+		t.AssertNil(err)
+		i := 0
+		for tok, err, eos := scanner.Next(); !eos; tok, err, eos = scanner.Next() {
+			t.AssertNil(err)
+			t.Assert(i < len(expected), "unexpected token %v", tok)
+			t.Assert(tok.(*Token).Equals(expected[i]), "expected %v got %v", expected[i], tok)
+			i++
+		}
+		t.Assert(i == len(expected), "expected %d tokens got %d", len(expected), i)
+
+		scanner, err = lexer.Scanner([]byte("a\n /* /* */ b"))
+		t.AssertNil(err)
+		scanner.Next()
+		_, err, _ = scanner.Next()
+		u, is := err.(*UnterminatedError)
+		t.Assert(is, "expected an UnterminatedError got %v", err)
+		t.Assert(u.Depth == 1 && u.StartTC == 3 && u.StartLine == 2 && u.StartColumn == 2, "got %#v", u)
+		t.Assert(err.Error() == `Lexer error: unterminated "/*" starting at 2:2, expected "*/"`, "got %v", err)
+	}
+	{
+		lexer := newLexer()
+		t.AssertNil(lexer.CompileNFA())
+		runTest(lexer)
+	}
+	{
+		lexer := newLexer()
+		t.AssertNil(lexer.CompileDFA())
+		runTest(lexer)
+	}
+}
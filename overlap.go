@@ -0,0 +1,108 @@
+package lexmachine
+
+import (
+	"fmt"
+
+	dfapkg "github.com/timtadh/lexmachine/dfa"
+)
+
+// An Overlap is a pair of patterns which can match the same lexeme. When they
+// do the pattern added first (A) wins, priority silently decides the token
+// type. Overlaps are usually intended (a keyword and the pattern for names)
+// but a Shadowed pattern can never produce a token and is almost certainly a
+// bug.
+type Overlap struct {
+	A, B     int    // the indexes of the patterns (in the order added, A < B)
+	Witness  []byte // a shortest lexeme matched by both patterns
+	Shadowed bool   // every lexeme B matches is matched by A (so B never wins)
+}
+
+// String formats the overlap for humans
+func (o Overlap) String() string {
+	if o.Shadowed {
+		return fmt.Sprintf("pattern %d shadows pattern %d (both match %q)", o.A, o.B, o.Witness)
+	}
+	return fmt.Sprintf("patterns %d and %d both match %q (pattern %d wins)", o.A, o.B, o.Witness, o.A)
+}
+
+// Overlaps computes every pair of patterns which can match the same lexeme.
+// See CompiledLexer.Overlaps.
+func (l *Lexer) Overlaps() ([]Overlap, error) {
+	c, err := l.Compiled()
+	if err != nil {
+		return nil, err
+	}
+	return c.Overlaps()
+}
+
+// Overlaps computes every pair of patterns which can match the same lexeme
+// ordered by A and then B. The analysis walks the product of the DFAs of each
+// pair of patterns so it takes time quadratic in the number of patterns.
+func (c *CompiledLexer) Overlaps() ([]Overlap, error) {
+	dfas, err := c.patternDFAs()
+	if err != nil {
+		return nil, err
+	}
+	overlaps := make([]Overlap, 0, len(dfas))
+	for a := range dfas {
+		for b := a + 1; b < len(dfas); b++ {
+			if witness, shadowed := overlap(dfas[a], dfas[b]); witness != nil {
+				overlaps = append(overlaps, Overlap{A: a, B: b, Witness: witness, Shadowed: shadowed})
+			}
+		}
+	}
+	return overlaps, nil
+}
+
+// overlap searches (breadth first) the product of the DFAs a and b for the
+// shortest string both accept (nil if there is none). It also reports if
+// every string b accepts is accepted by a.
+func overlap(a, b *dfapkg.DFA) (witness []byte, subset bool) {
+	type pair struct{ a, b int }
+	type step struct {
+		from pair
+		sym  byte
+	}
+	start := pair{a.Start, b.Start}
+	parents := map[pair]step{start: {}}
+	queue := []pair{start}
+	found := false
+	var end pair
+	subset = true
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		_, aAccepts := a.Accepting[p.a]
+		_, bAccepts := b.Accepting[p.b]
+		if bAccepts && !aAccepts {
+			subset = false
+		} else if aAccepts && bAccepts && !found {
+			found = true
+			end = p
+		}
+		if found && !subset {
+			break
+		}
+		for sym := 0; sym < 256; sym++ {
+			// only the strings b can still accept matter
+			next := pair{a.Trans[p.a][sym], b.Trans[p.b][sym]}
+			if next.b == b.Error {
+				continue
+			}
+			if _, seen := parents[next]; !seen {
+				parents[next] = step{p, byte(sym)}
+				queue = append(queue, next)
+			}
+		}
+	}
+	if !found {
+		return nil, false
+	}
+	for p := end; p != start; p = parents[p].from {
+		witness = append(witness, parents[p].sym)
+	}
+	for i, j := 0, len(witness)-1; i < j; i, j = i+1, j-1 {
+		witness[i], witness[j] = witness[j], witness[i]
+	}
+	return witness, subset
+}
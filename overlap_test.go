@@ -0,0 +1,38 @@
+package lexmachine
+
+import (
+	"testing"
+
+	"github.com/timtadh/data-structures/test"
+	"github.com/timtadh/lexmachine/machines"
+)
+
+func TestOverlaps(x *testing.T) {
+	t := (*test.T)(x)
+	newLexer := func() *Lexer {
+		lexer := NewLexer()
+		for _, p := range []string{`if`, `[a-z]+`, `[a-f]+`, `[0-9]+`, `0x[0-9a-f]+|[0-9]+\.[0-9]*`, ` +`} {
+			lexer.Add([]byte(p), func(s *Scanner, m *machines.Match) (interface{}, error) {
+				return nil, nil
+			})
+		}
+		return lexer
+	}
+	expected := []Overlap{
+		{A: 0, B: 1, Witness: []byte("if")},
+		{A: 1, B: 2, Witness: []byte("a"), Shadowed: true},
+	}
+	for _, compile := range []func(*Lexer) error{(*Lexer).CompileNFA, (*Lexer).CompileDFA} {
+		lexer := newLexer()
+		t.AssertNil(compile(lexer))
+		overlaps, err := lexer.Overlaps()
+		t.AssertNil(err)
+		t.Log(overlaps)
+		t.Assert(len(overlaps) == len(expected), "expected %v got %v", expected, overlaps)
+		for i, o := range overlaps {
+			e := expected[i]
+			t.Assert(o.A == e.A && o.B == e.B && string(o.Witness) == string(e.Witness) && o.Shadowed == e.Shadowed,
+				"expected %v got %v", e, o)
+		}
+	}
+}
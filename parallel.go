@@ -0,0 +1,266 @@
+package lexmachine
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// chunk holds the result of speculatively lexing one chunk of the text. The
+// scanner started at calls[0] (the start of the chunk) and called Next at
+// each of the positions in calls. The call at calls[i] produced tokens[i].
+// The last position in calls is either where the scanner stopped (at or past
+// the end of the chunk) or, if err or eos is set, where the final call
+// failed or found the end of the text. The scan of the chunk goes past its
+// end until no heredoc bodies are deferred (see HeredocConfig.Lines). If
+// stopped is set the scan stopped early at the last position in calls as the
+// chunk (or a chunk before it) reached the tokens limit.
+type chunk struct {
+	index      int
+	start, end int
+	scanner    *Scanner // forked from the scanner of the whole text
+	calls      []int
+	deferred   map[int]bool // the calls which started with heredoc bodies deferred
+	tokens     []interface{}
+	err        error
+	eos        bool
+	stopped    bool
+}
+
+// find returns the index in calls of the position tc. A call which started
+// with heredoc bodies deferred is not found as its tokens depend on them.
+func (c *chunk) find(tc int) (int, bool) {
+	i := sort.SearchInts(c.calls, tc)
+	return i, i < len(c.calls) && c.calls[i] == tc && !c.deferred[i]
+}
+
+// ScanParallel lexes text with up to workers goroutines (GOMAXPROCS if
+// workers <= 0) and returns the tokens in order. See
+// CompiledLexer.ScanParallel.
+func (l *Lexer) ScanParallel(text []byte, boundaries []int, workers int, options ...ScannerOption) ([]interface{}, error) {
+	c, err := l.Compiled()
+	if err != nil {
+		return nil, err
+	}
+	return c.ScanParallel(text, boundaries, workers, options...)
+}
+
+// ScanParallel lexes text with up to workers goroutines (GOMAXPROCS if
+// workers <= 0) and returns the tokens (the non-nil values returned by the
+// Actions) in order. It produces the same tokens as scanning the text with a
+// single Scanner, including the lines and columns and the token of the OnEOF
+// action, and stops at the first error a single Scanner would have returned.
+//
+// The text is split into chunks at the given boundaries (byte offsets into
+// text). If boundaries is nil the text is split speculatively into one chunk
+// per worker at newlines. Each chunk is lexed concurrently as if a token
+// started at its first byte. The chunks are then stitched together in order:
+// if the last token of a chunk extends past the next boundary, the text is
+// lexed sequentially from the end of that token until it reaches a position
+// where a token of the next chunk started (after which the tokens are the
+// same) or the end of the next chunk. So the boundaries only need to be
+// "safe" (no token crosses them) for the work to be done in parallel; other
+// boundaries cost extra sequential work but still give the correct result.
+//
+// Actions must not depend on state carried from one token to the next (other
+// than Scanner.TC) as the chunks are lexed independently. The Lexemes of the
+// tokens are slices of text (it is not copied) so it must not be modified
+// while the tokens are in use.
+func (c *CompiledLexer) ScanParallel(text []byte, boundaries []int, workers int, options ...ScannerOption) ([]interface{}, error) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if boundaries == nil {
+		boundaries = lineBoundaries(text, workers)
+	}
+	proto, err := c.scanner(text, false, options)
+	if err != nil {
+		return nil, err
+	}
+	chunks := makeChunks(len(text), boundaries)
+	// index the lines once and compute the position of the start of each
+	// chunk (in order) so the chunk scanners do not each walk the text up to
+	// their chunk
+	buffers := proto.config.Buffers
+	buffers.IndexLines()
+	for _, ch := range chunks {
+		if ch.start > 0 {
+			buffers.LineCol(ch.start - 1)
+		}
+		ch.scanner = proto.fork()
+	}
+	// the tokens limit applies to the stitched tokens. A chunk with more
+	// tokens than the limit (almost always) means the text has more tokens
+	// too so each chunk is capped by the limit (see chunk.lex).
+	maxTokens := proto.limits.MaxTokens
+	proto.limits.MaxTokens = 0
+	capped := int64(len(chunks))
+
+	var wg sync.WaitGroup
+	work := make(chan *chunk, len(chunks))
+	for _, ch := range chunks {
+		work <- ch
+	}
+	close(work)
+	for i := 0; i < workers && i < len(chunks); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ch := range work {
+				ch.lex(ch.scanner, &capped)
+			}
+		}()
+	}
+	wg.Wait()
+
+	tokens, calls, end, err := stitch(proto, chunks, maxTokens)
+	if err == nil && (maxTokens <= 0 || len(tokens) <= maxTokens) {
+		// the chunk scanners do not run the OnEOF action, run it (unless it
+		// ran while stitching)
+		proto.TC = end
+		var tok interface{}
+		var eos bool
+		tok, err, eos = proto.Next()
+		if err == nil && !eos {
+			tokens = append(tokens, tok)
+			calls = append(calls, end)
+		}
+	}
+	if maxTokens > 0 && len(tokens) > maxTokens {
+		proto.limits.MaxTokens = maxTokens
+		return tokens[:maxTokens], proto.limitError(TokenLimit, calls[maxTokens])
+	}
+	return tokens, err
+}
+
+// lex the chunk with the scanner s until the scanner reaches the end of the
+// chunk, the end of the text or an error. If the chunk reaches the tokens
+// limit of s it stops and records its index in capped (if it is lower): the
+// chunks after it then stop too as their tokens will not be needed. Unless
+// the chunk's tokens were not real (it started inside a token) in which case
+// stitch lexes on from where it stopped.
+func (ch *chunk) lex(s *Scanner, capped *int64) {
+	s.TC = ch.start
+	for s.TC < ch.end || s.deferred != nil {
+		if int64(ch.index) > atomic.LoadInt64(capped) {
+			ch.stopped = true
+			break
+		}
+		tc := s.TC
+		ch.calls = append(ch.calls, tc)
+		tok, err, eos := s.Next()
+		if l, is := err.(*LimitError); is && l.Limit == TokenLimit {
+			ch.stopped = true
+			for {
+				old := atomic.LoadInt64(capped)
+				if old <= int64(ch.index) || atomic.CompareAndSwapInt64(capped, old, int64(ch.index)) {
+					return
+				}
+			}
+		} else if err != nil {
+			ch.err = err
+			return
+		} else if eos {
+			ch.eos = true
+			return
+		}
+		ch.tokens = append(ch.tokens, tok)
+		if s.deferred != nil {
+			if ch.deferred == nil {
+				ch.deferred = make(map[int]bool)
+			}
+			ch.deferred[len(ch.tokens)] = true
+		}
+	}
+	ch.calls = append(ch.calls, s.TC)
+}
+
+// stitch joins the tokens of the chunks together, lexing sequentially with
+// scanner s where a token crosses a chunk boundary. The calls are the text
+// counters at which the calls to Next producing the tokens started and end is
+// where the scan stopped (the end of the text if it was reached). The tokens
+// of a chunk are only used from a call where neither s nor the chunk's
+// scanner have heredoc bodies deferred. Once there are more than maxTokens
+// tokens (if maxTokens > 0) stitch stops.
+func stitch(s *Scanner, chunks []*chunk, maxTokens int) (tokens []interface{}, calls []int, end int, err error) {
+	tokens = make([]interface{}, 0, len(chunks[0].tokens)*len(chunks))
+	calls = make([]int, 0, cap(tokens))
+	tc := 0
+	for i := 0; i < len(chunks); {
+		ch := chunks[i]
+		if tc >= ch.end && i+1 < len(chunks) {
+			i++
+			continue
+		}
+		if maxTokens > 0 && len(tokens) > maxTokens {
+			return tokens, calls, tc, nil
+		}
+		if j, found := ch.find(tc); found && s.deferred == nil && (j < len(ch.tokens) || !ch.stopped) {
+			tokens = append(tokens, ch.tokens[j:]...)
+			calls = append(calls, ch.calls[j:len(ch.tokens)]...)
+			tc = ch.calls[len(ch.calls)-1]
+			if ch.stopped {
+				// lex on sequentially from where the chunk stopped
+				continue
+			} else if ch.err != nil {
+				return tokens, calls, tc, ch.err
+			} else if ch.eos {
+				return tokens, calls, len(s.Text), nil
+			}
+			i++
+			continue
+		}
+		// resynchronize by lexing one token from tc
+		s.TC = tc
+		tok, err, eos := s.Next()
+		if err != nil {
+			return tokens, calls, tc, err
+		} else if eos {
+			return tokens, calls, len(s.Text), nil
+		}
+		tokens = append(tokens, tok)
+		calls = append(calls, tc)
+		tc = s.TC
+	}
+	return tokens, calls, tc, nil
+}
+
+// makeChunks creates the chunks for the text split at the boundaries.
+// Boundaries outside of the text or out of order are ignored.
+func makeChunks(n int, boundaries []int) []*chunk {
+	chunks := make([]*chunk, 0, len(boundaries)+1)
+	start := 0
+	for _, b := range boundaries {
+		if b <= start || b >= n {
+			continue
+		}
+		chunks = append(chunks, &chunk{index: len(chunks), start: start, end: b})
+		start = b
+	}
+	return append(chunks, &chunk{index: len(chunks), start: start, end: n})
+}
+
+// lineBoundaries splits text into n roughly equal chunks which start at the
+// beginning of a line.
+func lineBoundaries(text []byte, n int) []int {
+	boundaries := make([]int, 0, n)
+	size := len(text) / n
+	if size == 0 {
+		return boundaries
+	}
+	for i := 1; i < n; i++ {
+		b := i * size
+		if len(boundaries) > 0 && b <= boundaries[len(boundaries)-1] {
+			continue
+		}
+		for b < len(text) && text[b-1] != '\n' {
+			b++
+		}
+		if b >= len(text) {
+			break
+		}
+		boundaries = append(boundaries, b)
+	}
+	return boundaries
+}
@@ -1,10 +1,12 @@
 package queue
 
 // Queue is a fast unique items queue which stores positive integers up to a
-// fixed bound.
+// fixed bound. An item which has been popped is not pushed again until the
+// queue is cleared.
 type Queue struct {
 	list []uint32
 	set  []uint32
+	head int
 }
 
 // New creates a Queue where n-1 is the maximum positive integer which can be
@@ -16,10 +18,17 @@ func New(n int) *Queue {
 	return q
 }
 
+// Size returns the bound on the items in the queue (the n passed to New).
+func (q *Queue) Size() int { return len(q.set) }
+
+// Len returns the number of items in the queue
+func (q *Queue) Len() int { return len(q.list) - q.head }
+
 // Empty returns true if the queue is empty
-func (q *Queue) Empty() bool { return len(q.list) <= 0 }
+func (q *Queue) Empty() bool { return q.head >= len(q.list) }
 
-// Has checks the queue to see if pc is in it
+// Has checks the queue to see if pc is in it (or was popped from it since it
+// was cleared)
 func (q *Queue) Has(pc uint32) bool {
 	idx := q.set[pc]
 	return idx < uint32(len(q.list)) && q.list[idx] == pc
@@ -28,6 +37,7 @@ func (q *Queue) Has(pc uint32) bool {
 // Clear clears the queue
 func (q *Queue) Clear() {
 	q.list = q.list[:0]
+	q.head = 0
 }
 
 // Push adds an item to the queue
@@ -41,7 +51,7 @@ func (q *Queue) Push(pc uint32) {
 
 // Pop removes an item from the queue
 func (q *Queue) Pop() uint32 {
-	pc := q.list[len(q.list)-1]
-	q.list = q.list[:len(q.list)-1]
+	pc := q.list[q.head]
+	q.head++
 	return pc
 }
@@ -0,0 +1,44 @@
+package queue
+
+import (
+	"testing"
+
+	"github.com/timtadh/data-structures/test"
+)
+
+func TestQueue(x *testing.T) {
+	t := (*test.T)(x)
+	q := New(10)
+	t.Assert(q.Empty() && q.Len() == 0 && q.Size() == 10, "expected an empty queue")
+	q.Push(3)
+	q.Push(1)
+	q.Push(3)
+	q.Push(2)
+	t.Assert(q.Len() == 3, "expected 3 items got %d", q.Len())
+	// items come out in the order they were pushed
+	for _, pc := range []uint32{3, 1, 2} {
+		t.Assert(q.Pop() == pc, "expected %d", pc)
+	}
+	t.Assert(q.Empty(), "expected an empty queue")
+	q.Clear()
+	q.Push(3)
+	t.Assert(q.Len() == 1 && q.Pop() == 3, "expected 3 after Clear")
+}
+
+func TestQueuePopped(x *testing.T) {
+	t := (*test.T)(x)
+	// the engine follows the SPLITs and JMPs of a program by pushing their
+	// targets. an epsilon cycle (eg. (a*)*) pushes a pc which was already
+	// followed so a popped pc must not be pushed again until the queue is
+	// cleared or the engine never stops following the cycle.
+	q := New(10)
+	q.Push(0)
+	q.Push(1)
+	t.Assert(q.Pop() == 0, "expected 0")
+	q.Push(0)
+	t.Assert(q.Has(0) && q.Len() == 1, "expected 0 to be kept out of the queue")
+	t.Assert(q.Pop() == 1 && q.Empty(), "expected only 1 to be left")
+	q.Clear()
+	q.Push(0)
+	t.Assert(q.Len() == 1 && q.Pop() == 0, "expected 0 after Clear")
+}
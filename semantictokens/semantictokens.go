@@ -0,0 +1,237 @@
+// Package semantictokens encodes the tokens produced by a lexmachine Lexer as
+// Language Server Protocol semantic tokens. This allows an editor's syntax
+// highlighting to be driven directly from a lexer.
+//
+// Create a Legend (the token types and modifiers the server reports to the
+// client in its SemanticTokensLegend) and map the lexer's token types onto
+// it:
+//
+//     encoder, err := semantictokens.NewEncoder(semantictokens.StandardLegend, map[int]semantictokens.Style{
+//         tokenIds["ID"]:      {Type: "variable"},
+//         tokenIds["NUMBER"]:  {Type: "number"},
+//         tokenIds["COMMENT"]: {Type: "comment", Modifiers: []string{"documentation"}},
+//     })
+//     if err != nil {
+//         return err
+//     }
+//     data, err := encoder.Encode(text, tokens)
+//
+// The data is in the relative format of SemanticTokens.data: five integers
+// (deltaLine, deltaStart, length, tokenType, tokenModifiers) per token. Lines
+// and characters are zero based and characters count UTF-16 code units as
+// the protocol requires (regardless of the Scanner's position options).
+// Tokens which span several lines are split into one semantic token per line
+// as most clients do not support multiline tokens.
+package semantictokens
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/timtadh/lexmachine"
+)
+
+// Legend lists the token types and modifiers used to encode tokens. A token
+// type is encoded as its index in TokenTypes and the modifiers as a bit set
+// of their indices in TokenModifiers.
+type Legend struct {
+	TokenTypes     []string
+	TokenModifiers []string
+}
+
+// StandardLegend holds the token types and modifiers predefined by the
+// Language Server Protocol (version 3.17).
+var StandardLegend = Legend{
+	TokenTypes: []string{
+		"namespace", "type", "class", "enum", "interface", "struct",
+		"typeParameter", "parameter", "variable", "property", "enumMember",
+		"event", "function", "method", "macro", "keyword", "modifier",
+		"comment", "string", "number", "regexp", "operator", "decorator",
+	},
+	TokenModifiers: []string{
+		"declaration", "definition", "readonly", "static", "deprecated",
+		"abstract", "async", "modification", "documentation", "defaultLibrary",
+	},
+}
+
+// Style is the semantic token type and modifiers (by name) of a lexer token
+// type.
+type Style struct {
+	Type      string
+	Modifiers []string
+}
+
+// style is a Style encoded against a Legend.
+type style struct {
+	typ       uint32
+	modifiers uint32
+}
+
+// Encoder encodes lexmachine tokens as semantic tokens.
+type Encoder struct {
+	legend Legend
+	styles map[int]style
+}
+
+// NewEncoder creates an Encoder for the legend which encodes tokens with the
+// styles given for their Token.Type. Tokens whose type has no style are
+// skipped. It is an error for a style to use a type or modifier which is not
+// in the legend.
+func NewEncoder(legend Legend, styles map[int]Style) (*Encoder, error) {
+	types := make(map[string]uint32, len(legend.TokenTypes))
+	for i, name := range legend.TokenTypes {
+		types[name] = uint32(i)
+	}
+	modifiers := make(map[string]uint32, len(legend.TokenModifiers))
+	for i, name := range legend.TokenModifiers {
+		if i >= 32 {
+			return nil, fmt.Errorf("too many token modifiers (%d), at most 32 are supported", len(legend.TokenModifiers))
+		}
+		modifiers[name] = 1 << uint(i)
+	}
+	e := &Encoder{
+		legend: legend,
+		styles: make(map[int]style, len(styles)),
+	}
+	for tokType, s := range styles {
+		typ, has := types[s.Type]
+		if !has {
+			return nil, fmt.Errorf("token type %d has semantic token type %q which is not in the legend", tokType, s.Type)
+		}
+		encoded := style{typ: typ}
+		for _, name := range s.Modifiers {
+			bit, has := modifiers[name]
+			if !has {
+				return nil, fmt.Errorf("token type %d has semantic token modifier %q which is not in the legend", tokType, name)
+			}
+			encoded.modifiers |= bit
+		}
+		e.styles[tokType] = encoded
+	}
+	return e, nil
+}
+
+// Legend returns the legend the Encoder encodes against.
+func (e *Encoder) Legend() Legend {
+	return e.legend
+}
+
+// Encode the tokens of text in the relative SemanticTokens.data format. The
+// tokens must be in order and must not overlap (as the tokens produced by a
+// Scanner are). Their positions are taken from Token.TC and the length of
+// Token.Lexeme.
+func (e *Encoder) Encode(text []byte, tokens []*lexmachine.Token) ([]uint32, error) {
+	data := make([]uint32, 0, 5*len(tokens))
+	c := newCursor(text)
+	var prevLine, prevChar uint32
+	prevEnd := 0
+	emit := func(line, char, length uint32, s style) {
+		deltaStart := char
+		if line == prevLine {
+			deltaStart = char - prevChar
+		}
+		data = append(data, line-prevLine, deltaStart, length, s.typ, s.modifiers)
+		prevLine, prevChar = line, char
+	}
+	for _, tok := range tokens {
+		s, has := e.styles[tok.Type]
+		if !has {
+			continue
+		}
+		start, end := tok.TC, tok.TC+len(tok.Lexeme)
+		if start < prevEnd || end > len(text) {
+			return nil, fmt.Errorf("token %v is out of order or outside of the text", tok)
+		}
+		prevEnd = end
+		c.advance(start)
+		for c.tc < end {
+			// one semantic token for each line of the token
+			line, char := c.line, c.char
+			c.advanceLine(end)
+			if c.char > char {
+				emit(line, char, c.char-char, s)
+			}
+			c.skipNewline(end)
+		}
+	}
+	return data, nil
+}
+
+// EncodeScanner encodes all of the tokens produced by the scanner. The
+// Actions of the scanner's lexer must return *lexmachine.Token values (or
+// nil).
+func (e *Encoder) EncodeScanner(scanner *lexmachine.Scanner) ([]uint32, error) {
+	tokens := make([]*lexmachine.Token, 0, 10)
+	for tok, err, eos := scanner.Next(); !eos; tok, err, eos = scanner.Next() {
+		if err != nil {
+			return nil, err
+		}
+		t, is := tok.(*lexmachine.Token)
+		if !is {
+			return nil, fmt.Errorf("expected a *lexmachine.Token got %T", tok)
+		}
+		tokens = append(tokens, t)
+	}
+	return e.Encode(scanner.Text, tokens)
+}
+
+// cursor tracks the LSP position (zero based line and UTF-16 character) of
+// a text counter as it moves forward through the text. The protocol treats
+// \n, \r\n and \r as line endings.
+type cursor struct {
+	text []byte
+	tc   int
+	line uint32
+	char uint32
+}
+
+func newCursor(text []byte) *cursor {
+	return &cursor{text: text}
+}
+
+// advance moves the cursor forward to tc.
+func (c *cursor) advance(tc int) {
+	for c.tc < tc {
+		c.advanceLine(tc)
+		c.skipNewline(tc)
+	}
+}
+
+// advanceLine moves the cursor forward to tc or to the next line ending,
+// whichever comes first.
+func (c *cursor) advanceLine(tc int) {
+	for c.tc < tc {
+		b := c.text[c.tc]
+		if b == '\n' || b == '\r' {
+			return
+		}
+		r, size := utf8.DecodeRune(c.text[c.tc:])
+		if r >= 0x10000 {
+			c.char += 2
+		} else {
+			c.char++
+		}
+		c.tc += size
+	}
+}
+
+// skipNewline moves the cursor past the line ending at the cursor (if there
+// is one and it starts before tc).
+func (c *cursor) skipNewline(tc int) {
+	if c.tc >= tc {
+		return
+	}
+	switch c.text[c.tc] {
+	case '\r':
+		c.tc++
+		if c.tc < len(c.text) && c.text[c.tc] == '\n' {
+			c.tc++
+		}
+	case '\n':
+		c.tc++
+	default:
+		return
+	}
+	c.line++
+	c.char = 0
+}
@@ -0,0 +1,72 @@
+package semantictokens
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/timtadh/data-structures/test"
+	"github.com/timtadh/lexmachine"
+	"github.com/timtadh/lexmachine/machines"
+)
+
+const (
+	ident = iota
+	str
+	comment
+)
+
+func newLexer() *lexmachine.Lexer {
+	token := func(typ int) lexmachine.Action {
+		return func(s *lexmachine.Scanner, m *machines.Match) (interface{}, error) {
+			return s.Token(typ, string(m.Bytes), m), nil
+		}
+	}
+	lexer := lexmachine.NewLexer()
+	lexer.Add([]byte(`[a-z]+`), token(ident))
+	lexer.Add([]byte(`"[^"]*"`), token(str))
+	lexer.Add([]byte(`/\*([^*]|\*+[^*/])*\*+/`), token(comment))
+	lexer.Add([]byte(`( |\t|\r|\n)+`), func(*lexmachine.Scanner, *machines.Match) (interface{}, error) {
+		return nil, nil
+	})
+	return lexer
+}
+
+func TestEncode(x *testing.T) {
+	t := (*test.T)(x)
+	encoder, err := NewEncoder(StandardLegend, map[int]Style{
+		ident:   {Type: "variable", Modifiers: []string{"readonly"}},
+		comment: {Type: "comment", Modifiers: []string{"documentation", "deprecated"}},
+	})
+	t.AssertNil(err)
+	text := "ab \"\xf0\x9f\x98\x80\" cd /* x\r\n\xc3\xa9y\n */ \"\xf0\x9f\x98\x80\"\n\nef"
+	scanner, err := newLexer().Scanner([]byte(text))
+	t.AssertNil(err)
+	data, err := encoder.EncodeScanner(scanner)
+	t.AssertNil(err)
+	expected := []uint32{
+		0, 0, 2, 8, 4, // ab
+		0, 8, 2, 8, 4, // cd (the string is not styled, the emoji is 2 UTF-16 units)
+		0, 3, 4, 17, 272, // /* x
+		1, 0, 2, 17, 272, // éy
+		1, 0, 3, 17, 272, //  */
+		2, 0, 2, 8, 4, // ef
+	}
+	t.Assert(fmt.Sprint(data) == fmt.Sprint(expected), "expected %v got %v", expected, data)
+}
+
+func TestEncodeErrors(x *testing.T) {
+	t := (*test.T)(x)
+	_, err := NewEncoder(StandardLegend, map[int]Style{ident: {Type: "wat"}})
+	t.Assert(err != nil, "expected an error for an unknown type")
+	_, err = NewEncoder(StandardLegend, map[int]Style{ident: {Type: "variable", Modifiers: []string{"wat"}}})
+	t.Assert(err != nil, "expected an error for an unknown modifier")
+
+	encoder, err := NewEncoder(StandardLegend, map[int]Style{ident: {Type: "variable"}})
+	t.AssertNil(err)
+	text := []byte("ab cd")
+	_, err = encoder.Encode(text, []*lexmachine.Token{
+		{Type: ident, Lexeme: text[3:5], TC: 3},
+		{Type: ident, Lexeme: text[0:2], TC: 0},
+	})
+	t.Assert(err != nil, "expected an error for tokens out of order")
+}